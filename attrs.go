@@ -0,0 +1,93 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+/*
+	{{ attrs }} outputs the attributes of the component tag that aren't props
+	(all of them for components that don't declare their props), merged with
+	the component's defaults
+
+	_components/button.html: <button {{ attrs "class" "btn" "type" "button" }}>...</button>
+	<x-button class="btn-lg" type="submit" data-id="1">
+	==> <button class="btn btn-lg" data-id="1" type="submit">
+
+	class lists are merged, style declarations are concatenated and the
+	other attributes replace the component's defaults. an attribute whose value
+	is true, such as an attribute without a value (<x-button disabled>), is written
+	without a value and an attribute whose value is false isn't written.
+	{{ attrs }} is translated to {{ attrs $ }}, $ being the component's arguments
+*/
+
+// attrsFunc returns the attributes of args merged with defaults: "name1" value1 "name2" value2...
+func attrsFunc(args map[string]interface{}, defaults ...interface{}) (template.HTMLAttr, error) {
+	if len(defaults)%2 != 0 {
+		return "", fmt.Errorf("attrs: expects name value pairs")
+	}
+
+	attr := TagAttr{}
+	for i := 0; i < len(defaults); i += 2 {
+		addAttr(attr, fmt.Sprint(defaults[i]), defaults[i+1])
+	}
+
+	caller := TagAttr{}
+	given, _ := args["attrs"].(map[string]interface{})
+	for k, v := range given {
+		addAttr(caller, k, v)
+	}
+	attr.Merge(caller)
+
+	// false removes the attribute
+	for k, v := range attr {
+		if v.Bare && v.Value == "false" {
+			delete(attr, k)
+		}
+	}
+
+	return template.HTMLAttr(attr.String()), nil
+}
+
+// addAttr adds attribute key to a, a boolean is added as an attribute without a value
+func addAttr(a TagAttr, key string, value interface{}) {
+	_, isBool := value.(bool)
+	a.Add(key, fmt.Sprint(value), "")
+	a[key].Bare = isBool
+}
+
+// mergeClass adds the classes of add, that cls doesn't have, to cls
+func mergeClass(cls, add string) string {
+	classes := strings.Fields(cls)
+	for _, c := range strings.Fields(add) {
+		if !StrListIncludes(c, classes) {
+			classes = append(classes, c)
+		}
+	}
+
+	return strings.Join(classes, " ")
+}
+
+// mergeStyle appends the declarations of add to style
+func mergeStyle(style, add string) string {
+	style = strings.TrimRight(strings.TrimSpace(style), ";")
+	add = strings.TrimRight(strings.TrimSpace(add), ";")
+	if style == "" || add == "" {
+		return style + add
+	}
+
+	return style + "; " + add
+}
+
+// usesAttrs reports whether the component template src uses {{ attrs }}
+func (sx *syntax) usesAttrs(src []byte) bool {
+	return sx.attrsRe.Match(src)
+}
+
+// translateAttrs converts {{ attrs ... }} into {{ attrs $ ... }}
+func (sx *syntax) translateAttrs(src []byte, m srcMap) ([]byte, srcMap) {
+	return replaceAllFunc(sx.attrsRe, src, m, func(b []byte) []byte {
+		return []byte(string(b) + " $")
+	})
+}
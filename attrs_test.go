@@ -0,0 +1,85 @@
+package xtemplate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagAttr_Merge(t *testing.T) {
+
+	attr := TagAttr{}
+	attr.Add("class", "btn btn-sm", `class="btn btn-sm"`)
+	attr.Add("style", "color: red;", `style="color: red;"`)
+	attr.Add("id", "a", `id="a"`)
+
+	caller := TagAttr{}
+	caller.Add("class", "btn-lg btn", `class="btn-lg btn"`)
+	caller.Add("Style", "margin: 0", `Style="margin: 0"`)
+	caller.Add("id", "b", `id="b"`)
+	caller.Add("data-id", `"1"`, `data-id='"1"'`)
+	caller.Add("hidden", "", "hidden")
+	caller["hidden"].Bare = true
+
+	attr.Merge(caller)
+	assert.Equal(t, `class="btn btn-sm btn-lg" data-id="&#34;1&#34;" hidden id="b" style="color: red; margin: 0"`, attr.String())
+}
+
+func Test_attrs(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/button.html": {Data: []byte(`{{ props }}
+	label string
+{{ end }}
+<button {{ attrs "class" "btn" "type" "button" "style" "color: red" }}>{{ .props.label }}</button>`)},
+		"views/_components/box.html": {Data: []byte(`<div {{ attrs }}>{{ .props.title }}</div>`)},
+		"views/_components/card.html": {Data: []byte(`{{ props }}
+	title string
+{{ end }}
+<div>{{ .props.title }}</div>`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{"id": 7}
+
+	tests := []renderCase{
+		{
+			name:     "defaults",
+			src:      `<x-button label="ok" />`,
+			expected: `<button class="btn" style="color: red" type="button">ok</button>` + "\n",
+		},
+		{
+			name:     "merged",
+			src:      `<x-button label="ok" class="btn-lg" style="margin: 0;" type="submit" data-id="1" :data-user=".id" />`,
+			expected: `<button class="btn btn-lg" data-id="1" data-user="7" style="color: red; margin: 0" type="submit">ok</button>` + "\n",
+		},
+		{
+			name:     "without value",
+			src:      `<x-button label="ok" disabled hidden :type="false" />`,
+			expected: `<button class="btn" disabled hidden style="color: red">ok</button>` + "\n",
+		},
+		{
+			name:     "actions",
+			src:      `<x-box title="#{{ .id }}" data-id="{{ .id }}" data-pct="{{ .id }}%" />`,
+			expected: `<div data-id="7" data-pct="7%" title="#7">#7</div>` + "\n",
+		},
+		{
+			name:    "statement",
+			src:     `<x-box title="{{ if .id }}x{{ end }}" />`,
+			wantErr: true,
+		},
+		{
+			name:     "untyped",
+			src:      `<x-box title="<b>" id="x" />`,
+			expected: `<div id="x" title="&lt;b&gt;">&lt;b&gt;</div>` + "\n",
+		},
+		{
+			name:    "unknown prop",
+			src:     `<x-card title="a" id="x" />`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+}
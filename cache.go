@@ -0,0 +1,278 @@
+package xtemplate
+
+import (
+	"context"
+	"hash/fnv"
+	"html/template"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached template and the files it was built from
+type cacheEntry struct {
+	tpl  *template.Template
+	deps map[string]fileStamp
+	// src is used to map execution errors to the template files
+	src *sources
+	// stacks is set if the output of tpl has stacks to resolve
+	stacks bool
+	// meta is the metadata of the template, see XTemplate.Meta
+	meta map[string]interface{}
+	// proto is an unexecuted copy of tpl, kept when functions (or Go
+	// components) take a context so tpl can be cloned for each render
+	proto *template.Template
+}
+
+// newEntry parses template name into a cache entry
+func (s *XTemplate) newEntry(name string) (*cacheEntry, error) {
+	st := newParseState()
+	tpl, err := s.getTemplate(st, name)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.parseImports(st, tpl); err != nil {
+		return nil, err
+	}
+	if err = s.bindMacros(st, tpl); err != nil {
+		return nil, err
+	}
+	if err = s.checkRefs(st, tpl); err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{tpl: s.bindComponents(context.Background(), s.bindMeta(tpl, st.meta)), deps: st.deps, src: st.src, stacks: st.stacks, meta: st.meta}
+	if s.hasContextFuncs() || s.hasGoComponents() {
+		if entry.proto, err = tpl.Clone(); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// fileStamp identifies the version of a file a template was built from
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	hash    uint64
+	// absent is set for a file that didn't exist, the stamp changes once it does
+	absent bool
+	// dir is set for a folder, hash is then the hash of the names of its files
+	dir bool
+}
+
+// absentStamp is the stamp of a file that doesn't exist
+var absentStamp = fileStamp{absent: true}
+
+func newFileStamp(fsys fs.FS, name string, content []byte) fileStamp {
+	stamp := fileStamp{size: int64(len(content)), hash: hashContent(content)}
+	if fi, err := fs.Stat(fsys, name); err == nil {
+		stamp.modTime = fi.ModTime()
+	}
+
+	return stamp
+}
+
+// newDirStamp returns the stamp of folder name, the files it contains
+func newDirStamp(fsys fs.FS, name string) fileStamp {
+	return fileStamp{dir: true, hash: hashContent(dirListing(fsys, name))}
+}
+
+// dirListing returns the names of the files within folder name
+func dirListing(fsys fs.FS, name string) []byte {
+	var retv []byte
+	_ = fs.WalkDir(fsys, name, func(p string, d fs.DirEntry, err error) error {
+		if err == nil {
+			retv = append(append(retv, p...), 0)
+		}
+		return nil
+	})
+
+	return retv
+}
+
+func hashContent(content []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(content)
+	return h.Sum64()
+}
+
+// changed reports whether file name in fsys differs from the stamped version.
+// the modification time and size are compared, file systems that don't
+// report modification times (e.g embed.FS) have their contents hashed
+func (f fileStamp) changed(fsys fs.FS, name string) bool {
+	fi, err := fs.Stat(fsys, name)
+	if f.absent {
+		return err == nil
+	}
+	if err != nil {
+		return true
+	}
+
+	if f.dir {
+		return !fi.IsDir() || hashContent(dirListing(fsys, name)) != f.hash
+	}
+
+	if !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size {
+		return true
+	}
+
+	if !f.modTime.IsZero() {
+		return false
+	}
+
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return true
+	}
+
+	return hashContent(content) != f.hash
+}
+
+// stale reports whether any of the files the entry was built from changed
+func (e *cacheEntry) stale(fsys fs.FS) bool {
+	for name, stamp := range e.deps {
+		if stamp.changed(fsys, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCall is an in-flight or completed getTemplate call. concurrent cache
+// misses for the same template wait on a single parseCall
+type parseCall struct {
+	wg    sync.WaitGroup
+	entry *cacheEntry
+	err   error
+}
+
+// cacheKey returns the key a template is cached under,
+// i.e the template name without a file extension
+func (s *XTemplate) cacheKey(name string) string {
+	_, key := getFilename(s.rootFolder, name, s.ext)
+	return key
+}
+
+// cached returns the template cached under key
+func (s *XTemplate) cached(key string) (*cacheEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, found := s.cache[key]
+	return entry, found
+}
+
+// store caches entry under key
+func (s *XTemplate) store(key string, entry *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache[key] = entry
+}
+
+// evict removes entry from the cache if it is still cached under key
+func (s *XTemplate) evict(key string, entry *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache[key] == entry {
+		delete(s.cache, key)
+	}
+}
+
+// cachedTemplate returns the cached version of template name,
+// if the template isn't in the cache it is parsed and cached.
+// concurrent calls for the same uncached template parse it only once
+func (s *XTemplate) cachedTemplate(name string) (*cacheEntry, error) {
+	key := s.cacheKey(name)
+	if entry, found := s.cached(key); found {
+		if !s.reload || !entry.stale(s.fs) {
+			return entry, nil
+		}
+
+		s.evict(key, entry)
+	}
+
+	s.mu.Lock()
+	if entry, found := s.cache[key]; found {
+		s.mu.Unlock()
+		return entry, nil
+	}
+
+	if c, found := s.inflight[key]; found {
+		s.mu.Unlock()
+		c.wg.Wait()
+		if c.err != nil {
+			return nil, c.err
+		}
+		return c.entry, nil
+	}
+
+	c := new(parseCall)
+	c.wg.Add(1)
+	s.inflight[key] = c
+	s.mu.Unlock()
+
+	c.entry, c.err = s.newEntry(name)
+
+	s.mu.Lock()
+	if c.err == nil {
+		s.cache[key] = c.entry
+	}
+	delete(s.inflight, key)
+	s.mu.Unlock()
+	c.wg.Done()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.entry, nil
+}
+
+// Refresh removes every cached template whose files have changed
+// and returns the number of templates removed
+func (s *XTemplate) Refresh() int {
+	s.mu.RLock()
+	entries := make(map[string]*cacheEntry, len(s.cache))
+	for key, entry := range s.cache {
+		entries[key] = entry
+	}
+	s.mu.RUnlock()
+
+	count := 0
+	for key, entry := range entries {
+		if entry.stale(s.fs) {
+			s.evict(key, entry)
+			count++
+		}
+	}
+
+	return count
+}
+
+// Watch polls the files of cached templates every interval and removes
+// templates whose files changed from the cache. call stop to end polling
+func (s *XTemplate) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.Refresh()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
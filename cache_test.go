@@ -0,0 +1,208 @@
+package xtemplate
+
+import (
+	"bytes"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingFS counts the number of times each file is read
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	c.mu.Lock()
+	c.reads[name]++
+	c.mu.Unlock()
+
+	return fs.ReadFile(c.FS, name)
+}
+
+func (c *countingFS) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.reads[name]
+}
+
+// run with go test -race
+func TestConcurrentRender(t *testing.T) {
+
+	xt := New(Config{RootFolder: "./samples", Ext: "html"})
+	data := map[string]interface{}{
+		"name": "dinma", "age": 18,
+	}
+
+	tests := []struct {
+		tpl      string
+		expected string
+	}{
+		{tpl: "plain", expected: "dinma is 18\n"},
+		{tpl: "plain.html", expected: "dinma is 18\n"},
+		{tpl: "overlay", expected: "The Base\n\n\n** Master\n\n    original master body\n    with overlay\n\n\n===\n"},
+		{tpl: "sub/plain", expected: "dinma is 18\n"},
+		{tpl: "functions", expected: "dinma is 18\nmy name is dinma\n\nmy name is dinma\n\ndinma is my name"},
+	}
+
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	for i := 0; i < 50; i++ {
+		for _, tt := range tests {
+			wg.Add(1)
+			go func(tpl, expected string) {
+				defer wg.Done()
+
+				buff := bytes.NewBufferString("")
+				if err := xt.Render(buff, tpl, data, false); err != nil || buff.String() != expected {
+					atomic.AddInt32(&failed, 1)
+				}
+
+				if _, err := xt.RenderString(`{{ upper(.name) }}`, data); err != nil {
+					atomic.AddInt32(&failed, 1)
+				}
+
+				xt.Lookup(tpl)
+			}(tt.tpl, tt.expected)
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		xt.AddFunc("double", func(i int) int { return i * 2 })
+	}()
+
+	wg.Wait()
+	assert.Equal(t, int32(0), failed)
+	assert.NotNil(t, xt.Lookup("overlay"))
+}
+
+func TestConcurrentCacheMiss(t *testing.T) {
+
+	fsys := &countingFS{
+		FS: fstest.MapFS{
+			"page.html": {Data: []byte(`hello {{.}}`)},
+		},
+		reads: map[string]int{},
+	}
+	xt := New(Config{FS: fsys, Ext: "html"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buff := bytes.NewBufferString("")
+			assert.NoError(t, xt.Render(buff, "page", "world", false))
+			assert.Equal(t, "hello world", buff.String())
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, fsys.count("page.html"))
+}
+
+func TestReload(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"master.html":           {Data: []byte(`[{{block "body" .}}{{end}}]`)},
+		"a.html":                {Data: []byte(`{{extends "master.html"}}{{define "body"}}<component type="card"></component>{{end}}`)},
+		"b.html":                {Data: []byte(`{{extends "master.html"}}{{define "body"}}plain{{end}}`)},
+		"_components/card.html": {Data: []byte(`card`)},
+	}
+	xt := New(Config{FS: fsys, Ext: "html", Reload: true})
+
+	render := func(name string) string {
+		buff := bytes.NewBufferString("")
+		assert.NoError(t, xt.Render(buff, name, nil, false))
+		return buff.String()
+	}
+
+	assert.Equal(t, "[card\n]", render("a"))
+	assert.Equal(t, "[plain]", render("b"))
+	a, b := xt.Lookup("a"), xt.Lookup("b")
+
+	// a component change only refreshes the pages using the component
+	fsys["_components/card.html"] = &fstest.MapFile{Data: []byte(`new card`)}
+	assert.Equal(t, "[new card\n]", render("a"))
+	assert.Equal(t, "[plain]", render("b"))
+	assert.NotSame(t, a, xt.Lookup("a"))
+	assert.Same(t, b, xt.Lookup("b"))
+
+	// a master change refreshes every page extending it
+	a = xt.Lookup("a")
+	fsys["master.html"] = &fstest.MapFile{Data: []byte(`({{block "body" .}}{{end}})`)}
+	assert.Equal(t, "(new card\n)", render("a"))
+	assert.Equal(t, "(plain)", render("b"))
+	assert.NotSame(t, a, xt.Lookup("a"))
+	assert.NotSame(t, b, xt.Lookup("b"))
+}
+
+func TestRefresh(t *testing.T) {
+
+	modTime := time.Now()
+	fsys := fstest.MapFS{
+		"a.html": {Data: []byte(`a`), ModTime: modTime},
+		"b.html": {Data: []byte(`b`), ModTime: modTime},
+	}
+	xt := New(Config{FS: fsys, Ext: "html"})
+	assert.NoError(t, xt.ParseFile("a"))
+	assert.NoError(t, xt.ParseFile("b"))
+	assert.Equal(t, 0, xt.Refresh())
+
+	fsys["a.html"] = &fstest.MapFile{Data: []byte(`A`), ModTime: modTime.Add(time.Second)}
+	assert.Equal(t, 1, xt.Refresh())
+	assert.Nil(t, xt.Lookup("a"))
+	assert.NotNil(t, xt.Lookup("b"))
+}
+
+func TestReloadMissing(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"card.html":           {Data: []byte(`<component type="card"></component>`)},
+		"promo.html":          {Data: []byte(`[{{ include "promo-box.html" ignore missing }}]`)},
+		"sale.html":           {Data: []byte(`[{{ include ["sale-box.html", "box.html"] }}]`)},
+		"nav.html":            {Data: []byte(`[{{ template "link" }}]`)},
+		"box.html":            {Data: []byte(`box`)},
+		"_partials/base.html": {Data: []byte(`{{ define "link" }}link{{ end }}`)},
+	}
+	xt := New(Config{FS: fsys, Ext: "html", Reload: true})
+
+	render := func(name string) string {
+		buff := bytes.NewBufferString("")
+		assert.NoError(t, xt.Render(buff, name, nil, false))
+		return buff.String()
+	}
+
+	assert.Contains(t, render("card"), "unknown component card")
+	assert.Equal(t, "[]", render("promo"))
+	assert.Equal(t, "[box]", render("sale"))
+	assert.Equal(t, "[link]", render("nav"))
+	nav := xt.Lookup("nav")
+
+	// the files that didn't exist are picked up once they're added
+	fsys["_components/card.html"] = &fstest.MapFile{Data: []byte(`card`)}
+	fsys["promo-box.html"] = &fstest.MapFile{Data: []byte(`promo`)}
+	fsys["sale-box.html"] = &fstest.MapFile{Data: []byte(`sale`)}
+	assert.Equal(t, "card\n", render("card"))
+	assert.Equal(t, "[promo]", render("promo"))
+	assert.Equal(t, "[sale]", render("sale"))
+	assert.Same(t, nav, xt.Lookup("nav"))
+
+	// so are partials
+	fsys["_partials/links.html"] = &fstest.MapFile{Data: []byte(`{{ define "other" }}other{{ end }}`)}
+	assert.Equal(t, "[link]", render("nav"))
+	assert.NotSame(t, nav, xt.Lookup("nav"))
+}
@@ -0,0 +1,319 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"text/template/parse"
+)
+
+/*
+	{{ call name(args) }}body{{ end }} calls macro name with a body it renders with {{ caller }}.
+	the body is rendered with the data of the caller
+
+	{{ defmacro panel(title) }}<div class="panel"><h2>{{ .title }}</h2>{{ caller }}</div>{{ end }}
+	{{ call panel("Orders") }}<p>{{ .Count }} orders</p>{{ end }}
+
+	the body is moved to a template of its own and the call is translated into
+	{{ template "panel" withCaller "panel__caller_1" . (kwargs) ("Orders") }}. a macro that
+	isn't declared with defmacro has to be called with keyword arguments, the caller is added
+	to its map as caller. once parsed, {{ caller }} within the macros called with a body is
+	translated into {{ caller $ }} unless the user registered a caller function
+
+	the variables of the caller used by the body, $ included, are passed to the body
+	and declared again at its start
+
+	{{ range $i, $item := .Items }}{{ call panel($item.Name) }}{{ $i }}{{ end }}{{ end }}
+	--> {{ template "panel" withCaller "panel__caller_1" . (kwargs "$i" $i) ($item.Name) }}
+	{{ define "panel__caller_1" }}{{ $i := index .vars "$i" }}{{ range args .scope }}{{ $i }}{{ end }}{{ end }}
+
+	the body is rendered within the range so its data is still the data of the caller,
+	$ is renamed to $__root
+*/
+
+// the name of $ within the bodies of calls
+const callerRoot = "$__root"
+
+// {{ if, {{ range... {{ end
+var blockActionRe = regexp.MustCompile(`^-?\s*(if|range|with|block|define|end)\b`)
+
+// macroCaller is the body of a call to a macro, the data of the caller and the
+// caller's variables used by the body
+type macroCaller struct {
+	name  string
+	scope interface{}
+	vars  map[string]interface{}
+}
+
+// withCaller adds the caller body name, rendered with scope and vars, to the arguments of a macro
+func withCaller(name string, scope interface{}, vars map[string]interface{}, data interface{}) (interface{}, error) {
+	args, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("call: the macro's arguments must be a map")
+	}
+
+	retv := make(map[string]interface{}, len(args)+1)
+	for k, v := range args {
+		retv[k] = v
+	}
+	retv["caller"] = &macroCaller{name: name, scope: scope, vars: vars}
+
+	return retv, nil
+}
+
+// callerFunc returns the caller function of tpl: it renders the body passed to the macro
+func (s *XTemplate) callerFunc(tpl *template.Template) interface{} {
+	return func(args interface{}) (template.HTML, error) {
+		m, _ := args.(map[string]interface{})
+		c, ok := m["caller"].(*macroCaller)
+		if !ok || tpl == nil {
+			return "", fmt.Errorf("caller used outside of a macro called with a body")
+		}
+
+		data := c.scope
+		if len(c.vars) > 0 {
+			data = map[string]interface{}{"scope": c.scope, "vars": c.vars}
+		}
+
+		buff := bytes.NewBufferString("")
+		if err := tpl.ExecuteTemplate(buff, c.name, data); err != nil {
+			return "", err
+		}
+
+		return template.HTML(buff.String()), nil
+	}
+}
+
+// translateCalls moves the bodies of the {{ call }} actions of src into templates
+// of their own, {{ define "name__caller_N" }}body{{ end }} at the end of src, and
+// converts the calls into template actions
+func translateCalls(xt *XTemplate, st *parseState, imports map[string]string, src []byte, m srcMap) ([]byte, srcMap, error) {
+	sx := xt.syntax()
+
+	for {
+		loc := sx.callRe.FindSubmatchIndex(src)
+		if loc == nil {
+			break
+		}
+
+		m = m.ensure(src)
+		bodyEnd, end, found := sx.blockEnd(src, loc[1])
+		if !found {
+			return nil, nil, newTemplateError(m.at(src, loc[0]), "call: can't find the end of the call")
+		}
+
+		st.callers++
+		name := macroName(imports, string(src[loc[4]:loc[5]]))
+		body := fmt.Sprintf("%s__caller_%d", name, st.callers)
+		args := strings.TrimSpace(macroArgs(src[loc[6]:loc[7]]))
+		if args == "" {
+			args = "kwargs"
+		}
+		vars, content := sx.bodyVars(src[loc[1]:bodyEnd])
+		passed, declared := "kwargs", ""
+		for _, v := range vars {
+			passed += fmt.Sprintf(" %q %s", v, v)
+			if v == "$" {
+				declared += sx.action("%s := index .vars %q", callerRoot, v)
+				continue
+			}
+			declared += sx.action("%s := index .vars %q", v, v)
+		}
+
+		trimL, trimR := string(src[loc[2]:loc[3]]), string(src[loc[8]:loc[9]])
+		call := sx.action("%s template %q withCaller %q . (%s) (%s) %s", trimL, name, body, passed, args, trimR)
+
+		callMap := m.lines(src, loc[0], loc[1])
+		b := docBuilder{}
+		b.copy(src, m, 0, loc[0])
+		b.replace(src, m, loc[0], loc[1], []byte(call), nil)
+		b.copy(src, m, end, len(src))
+		b.write([]byte(sx.action("define %q", body)), callMap[:1])
+		if len(vars) > 0 {
+			b.write([]byte(declared+sx.action("range args .scope")), callMap[:1])
+		}
+		b.write(content, m.lines(src, loc[1], bodyEnd))
+		closing := sx.action("end")
+		if len(vars) > 0 {
+			// the end of the range
+			closing += sx.action("end")
+		}
+		b.replace(src, m, bodyEnd, end, []byte(closing), nil)
+
+		src, m = b.result()
+	}
+
+	return src, m, nil
+}
+
+// passCaller translates the {{ caller }} commands of the templates of tpl named in called,
+// the macros called with a body, into {{ caller $ }}
+func (s *XTemplate) passCaller(tpl *template.Template, called map[string]bool) {
+	if len(called) == 0 || s.userFunc("caller") {
+		return
+	}
+
+	for name := range called {
+		t := tpl.Lookup(name)
+		if t == nil || t.Tree == nil {
+			continue
+		}
+
+		for _, cmd := range callerCmds(t.Tree.Root, nil) {
+			cmd.Args = append(cmd.Args, &parse.VariableNode{NodeType: parse.NodeVariable, Pos: cmd.Pos, Ident: []string{"$"}})
+		}
+	}
+}
+
+// callerCmds returns the {{ caller }} commands, without arguments, within node
+func callerCmds(node parse.Node, found []*parse.CommandNode) []*parse.CommandNode {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return found
+		}
+		for _, c := range n.Nodes {
+			found = callerCmds(c, found)
+		}
+	case *parse.ActionNode:
+		found = callerCmds(n.Pipe, found)
+	case *parse.TemplateNode:
+		found = callerCmds(n.Pipe, found)
+	case *parse.IfNode:
+		found = callerCmds(n.List, callerCmds(n.ElseList, callerCmds(n.Pipe, found)))
+	case *parse.RangeNode:
+		found = callerCmds(n.List, callerCmds(n.ElseList, callerCmds(n.Pipe, found)))
+	case *parse.WithNode:
+		found = callerCmds(n.List, callerCmds(n.ElseList, callerCmds(n.Pipe, found)))
+	case *parse.PipeNode:
+		if n == nil {
+			return found
+		}
+		for _, cmd := range n.Cmds {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "caller" && len(cmd.Args) == 1 {
+				found = append(found, cmd)
+			}
+			for _, arg := range cmd.Args {
+				found = callerCmds(arg, found)
+			}
+		}
+	}
+
+	return found
+}
+
+// callerCmd returns the withCaller command of the {{ template }} action of a {{ call }}
+func callerCmd(n *parse.TemplateNode) *parse.CommandNode {
+	if n.Pipe == nil || len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) != 1 || len(n.Pipe.Cmds[0].Args) != 5 {
+		return nil
+	}
+
+	cmd := n.Pipe.Cmds[0]
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "withCaller" {
+		return cmd
+	}
+
+	return nil
+}
+
+// bodyVars returns the variables used by body, the body of a call, that aren't declared
+// within it. $ is renamed to callerRoot in the returned body
+func (sx *syntax) bodyVars(body []byte) ([]string, []byte) {
+	var (
+		vars     []string
+		declared = map[string]bool{}
+		out      []byte
+		pos      int
+	)
+
+	for {
+		start := bytes.Index(body[pos:], []byte(sx.left))
+		if start < 0 {
+			break
+		}
+		start += pos
+
+		act, ok := sx.scanAction(body, start)
+		if !ok {
+			break
+		}
+
+		// the variables before := are declared
+		decl := false
+		for _, tok := range act.tokens {
+			if tok.typ == tokAssign && tok.text == ":=" {
+				decl = true
+				break
+			}
+		}
+
+		text := act.prefix
+		for _, tok := range act.tokens {
+			switch {
+			case tok.typ == tokAssign:
+				decl = false
+			case tok.typ != tokVariable:
+			case decl:
+				declared[varName(tok.text)] = true
+			default:
+				name := varName(tok.text)
+				if name == "$" {
+					tok.text = callerRoot + tok.text[1:]
+				}
+				if !declared[name] && !StrListIncludes(name, vars) {
+					vars = append(vars, name)
+				}
+			}
+			text += tok.text
+		}
+
+		out = append(out, body[pos:start]...)
+		if len(act.tokens) > 0 {
+			out = append(out, text+act.suffix...)
+		} else {
+			out = append(out, act.src...)
+		}
+		pos = act.end
+	}
+	out = append(out, body[pos:]...)
+
+	return vars, out
+}
+
+// varName returns the name of the variable of $x.Field
+func varName(s string) string {
+	if i := strings.Index(s[1:], "."); i >= 0 {
+		return s[:i+1]
+	}
+
+	return s
+}
+
+// blockEnd returns the offsets of the {{ end }} closing the block whose body starts at
+// offset start of src
+func (sx *syntax) blockEnd(src []byte, start int) (int, int, bool) {
+	depth := 1
+	for _, loc := range sx.actionRe.FindAllIndex(src[start:], -1) {
+		act := src[start+loc[0] : start+loc[1]]
+		if sx.callRe.Match(act) {
+			depth++
+			continue
+		}
+
+		kw := blockActionRe.FindSubmatch(act[len(sx.left) : len(act)-len(sx.right)])
+		switch {
+		case kw == nil:
+		case string(kw[1]) != "end":
+			depth++
+		default:
+			depth--
+			if depth == 0 {
+				return start + loc[0], start + loc[1], true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,126 @@
+package xtemplate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCall(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/layout.html": {Data: []byte(`{{ defmacro panel(title, kind="default") -}}
+<div class="panel-{{ .kind }}"><h2>{{ .title }}</h2>{{ caller }}</div>
+{{- end }}
+{{ define "card" }}<div class="card">{{ .title }}: {{ caller }}</div>{{ end }}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{"count": 3, "user": "ayo", "items": []string{"a", "b"}}
+
+	tests := []renderCase{
+		{
+			name:     "caller scope",
+			src:      `{{ include "layout.html" }}{{ call panel("Orders") }}<p>{{ .count }} orders</p>{{ end }}`,
+			expected: `<div class="panel-default"><h2>Orders</h2><p>3 orders</p></div>`,
+		},
+		{
+			name: "nested",
+			src: `{{ include "layout.html" }}{{ call panel("Outer", "main") }}
+{{- if .user }}{{ call panel("kind"::"inner", "title"::.user) }}hi {{ .user }}{{ end }}{{ end -}}
+{{ end }}`,
+			expected: `<div class="panel-main"><h2>Outer</h2><div class="panel-inner"><h2>ayo</h2>hi ayo</div></div>`,
+		},
+		{
+			name:     "within a define",
+			src:      `{{ include "layout.html" }}{{ define "body" }}{{ call panel("T") }}{{ .user }}{{ end }}{{ end }}{{ template "body" . }}`,
+			expected: `<div class="panel-default"><h2>T</h2>ayo</div>`,
+		},
+		{
+			name:     "commas in strings",
+			src:      `{{ include "layout.html" }}{{ call panel("Hello, world", "a, b") }}{{ .user }}{{ end }}`,
+			expected: `<div class="panel-a, b"><h2>Hello, world</h2>ayo</div>`,
+		},
+		{
+			name:     "range variables",
+			src:      `{{ include "layout.html" }}{{ range $i, $it := .items }}{{ call panel($it) }}{{ $i }}:{{ $it }} {{ . }}{{ end }}{{ end }}`,
+			expected: `<div class="panel-default"><h2>a</h2>0:a a</div><div class="panel-default"><h2>b</h2>1:b b</div>`,
+		},
+		{
+			name:     "variables",
+			src:      `{{ include "layout.html" }}{{ $x := "X" }}{{ call panel("T") }}{{ $x }}{{ $y := 1 }}{{ $y }} {{ $.user }}{{ end }}`,
+			expected: `<div class="panel-default"><h2>T</h2>X1 ayo</div>`,
+		},
+		{
+			name: "nested variables",
+			src: `{{ include "layout.html" }}{{ range $it := .items }}{{ call panel("Outer") }}
+{{- call panel($it) }}{{ $it }}{{ $.count }}{{ end }}{{ end }}{{ end }}`,
+			expected: `<div class="panel-default"><h2>Outer</h2><div class="panel-default"><h2>a</h2>a3</div></div>` +
+				`<div class="panel-default"><h2>Outer</h2><div class="panel-default"><h2>b</h2>b3</div></div>`,
+		},
+		{
+			name:     "keyword arguments",
+			src:      `{{ include "layout.html" }}{{ call card("title"::"Name") }}{{ .user }}{{ end }}`,
+			expected: `<div class="card">Name: ayo</div>`,
+		},
+		{
+			name:     "imported",
+			src:      `{{ import "layout.html" as l }}{{ call l.panel("Orders") }}{{ .count }}{{ end }}`,
+			expected: `<div class="panel-default"><h2>Orders</h2>3</div>`,
+		},
+		{
+			name:    "positional arguments",
+			src:     `{{ include "layout.html" }}{{ call card("Name") }}{{ .user }}{{ end }}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing required",
+			src:     `{{ include "layout.html" }}{{ call panel() }}x{{ end }}`,
+			wantErr: true,
+		},
+		{
+			name:    "no end",
+			src:     `{{ include "layout.html" }}{{ call panel("T") }}x`,
+			wantErr: true,
+		},
+		{
+			name:    "caller outside a call",
+			src:     `{{ caller }}`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+}
+
+func TestUserCaller(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/layout.html": {Data: []byte(`{{ defmacro panel(title) }}<h2>{{ .title }}</h2>{{ caller }}{{ end }}`)},
+	}
+
+	// a caller function registered by the user isn't replaced
+	xt := New(Config{FS: fsys, RootFolder: "views", Funcs: map[string]interface{}{
+		"caller": func(name ...string) string { return "called " + strings.Join(name, " ") },
+	}})
+
+	tests := []renderCase{
+		{
+			name:     "template",
+			src:      `{{ caller }} {{ caller "ayo" }}`,
+			expected: `called  called ayo`,
+		},
+		{
+			name:     "macro",
+			src:      `{{ include "layout.html" }}{{ template "panel" "T" }}`,
+			expected: `<h2>T</h2>called `,
+		},
+		{
+			name:     "macro called with a body",
+			src:      `{{ include "layout.html" }}{{ call panel("T") }}x{{ end }}`,
+			expected: `<h2>T</h2>called `,
+		},
+	}
+
+	renderCases(t, xt, nil, tests)
+}
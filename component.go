@@ -2,15 +2,22 @@ package xtemplate
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
+	"html"
+	"io/fs"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 /*
 	- A component is an HTML tag <component type="card"></component>
+		<component type="card" /> is a component without content and
+		<x-card></x-card> is short for <component type="card"></component>
+	- The folders of components in sub folders of the component folder are separated
+		by dots or slashes: <x-forms.input> or <component type="forms/input">
 	- Every valid component must have an id attribute
 	- A template file whose name is the value of id attribute must exist in the component template folder
 	- A component template must be a valid go text/template
@@ -53,16 +60,23 @@ import (
 
 // var componentStartRe = regexp.MustCompile(`(?i)<(component|slot)\s+(id|name)="([a-zA-Z0-9\-\_]*?)"\s*>`)
 // var componentEndRe = regexp.MustCompile(`</(component|slot)>`)
-var attrRe = regexp.MustCompile(`(?i)\s([a-z]*?)="([\w\W]*?)"|'([\w\W]*?)'`)
-var htmlTagRe = regexp.MustCompile(`</*([a-zA-Z]+)([\s="a-zA-Z0-9\-_]*?)>`)
-var actionTagRe = regexp.MustCompile(`{{-*\s*([\w]+)\s?([\s\w"-.$:=]*?)\s*-*}}`)
+// attribute names are any characters but spaces and "'>/=: @click, :value, x-on:click.prevent
+// the value is optional: <x-button disabled>
+var attrRe = regexp.MustCompile(`\s([^\s"'>/=]+)(?:=(?:"([^"]*)"|'([^']*)'))?`)
+var htmlTagRe = regexp.MustCompile(`</*([a-zA-Z][\w\-.]*)((?:\s+[^\s"'>/=]+(?:="[^"]*"|='[^']*')?)*)\s*(/?)>`)
 var inQuotes = regexp.MustCompile(`"([\s\w#-.$:=]*?)"`)
+var identRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// .slots or hasSlot in a component template
+var slotsUsedRe = regexp.MustCompile(`\.slots\b|\bhasSlot\b`)
+var hasSlotRe = regexp.MustCompile(`\bhasSlot\b`)
 
 type tagType int
 
 const (
 	OpeningTag tagType = iota
 	ClosingTag
+	SelfClosingTag
 )
 
 type Tag struct {
@@ -73,24 +87,82 @@ type Tag struct {
 	EndPos   int
 	Type     tagType
 	Body     string
+	BodyPos  int
 	Attr     TagAttr
+
+	// shorthand is set for <x-name> components, whose type attribute is a prop
+	shorthand bool
 }
 
 type Attr struct {
 	Key   string
 	Value string
 	Src   string
+	// Bare is set for an attribute without a value: <input disabled>
+	Bare bool
 }
 
 type TagAttr map[string]*Attr
 
+// Merge adds attrs to a: class lists are merged, style declarations
+// are concatenated and the other attributes of attrs replace those of a
 func (a *TagAttr) Merge(attrs TagAttr) {
 	for k, v := range attrs {
-		switch k {
-		case "class":
-			(*a)[k].Value = v.Value
+		key := strings.ToLower(k)
+		cur := a.get(key)
+		if cur == nil {
+			a.Add(key, v.Value, v.Src)
+			(*a)[key].Bare = v.Bare
+			continue
+		}
+
+		switch {
+		case v.Bare && (key == "class" || key == "style"):
+		case key == "class":
+			cur.Value = mergeClass(cur.Value, v.Value)
+		case key == "style":
+			cur.Value = mergeStyle(cur.Value, v.Value)
+		default:
+			cur.Value, cur.Bare = v.Value, v.Bare
 		}
+		cur.Src = cur.String()
+	}
+}
+
+// get returns attribute key, attribute names aren't case sensitive
+func (a TagAttr) get(key string) *Attr {
+	for k, v := range a {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// String returns the attributes, sorted by name, as they're written in a tag
+func (a TagAttr) String() string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	retv := make([]string, 0, len(keys))
+	for _, k := range keys {
+		retv = append(retv, a[k].String())
+	}
+
+	return strings.Join(retv, " ")
+}
+
+// String returns the attribute as it's written in a tag: key="value" or key
+func (a *Attr) String() string {
+	if a.Bare {
+		return strings.ToLower(a.Key)
 	}
+
+	return fmt.Sprintf(`%s="%s"`, strings.ToLower(a.Key), html.EscapeString(a.Value))
 }
 
 func (a *TagAttr) Add(key, val, src string) {
@@ -104,6 +176,11 @@ func (a *TagAttr) Add(key, val, src string) {
 
 }
 
+// blockID returns the component's name as used in the names of its blocks
+func (t Tag) blockID() string {
+	return strings.ReplaceAll(t.ID, "/", ".")
+}
+
 func (t Tag) getSrc(src []byte) []byte {
 	return src[t.StartPos:t.EndPos]
 }
@@ -111,10 +188,35 @@ func (t Tag) Equal(tag *Tag) bool {
 	return t.Element == tag.Element && t.Type == tag.Type && t.Name == tag.Name && t.ID == tag.ID
 }
 
-func translateComponents(tpl *XTemplate, src Document) ([]byte, error) {
+// offsetError is an error found at offset pos of a document
+type offsetError struct {
+	pos int
+	msg string
+}
+
+func (e *offsetError) Error() string {
+	return e.msg
+}
+
+// errorAt returns err, found in src at offset pos (plus the offset of an *offsetError),
+// as a *TemplateError. m is the srcMap of src
+func errorAt(err error, src []byte, m srcMap, pos int) error {
+	var oErr *offsetError
+	if errors.As(err, &oErr) {
+		pos += oErr.pos
+	}
+
+	return newTemplateError(m.at(src, pos), "%s", err)
+}
+
+// translateComponents inlines the templates of the components used in src,
+// m is the srcMap of src
+func translateComponents(tpl *XTemplate, st *parseState, src Document, m srcMap) ([]byte, srcMap, error) {
 
 	cCount := 0
 	tplFolder := tpl.componentsFolder
+	sx := tpl.syntax()
+	m = m.ensure(src)
 
 	for {
 		// log.Println(src.String())
@@ -125,84 +227,185 @@ func translateComponents(tpl *XTemplate, src Document) ([]byte, error) {
 
 		components, err := listComponents(src)
 		if err != nil {
-			return nil, err
+			return nil, nil, errorAt(err, src, m, 0)
 		}
 		if len(components) == 0 {
 			break
 		}
 
-		cCount++
-		cTpl, err := getComponentTemplate(tag.ID, tplFolder, tpl.ext)
+		slots, err := listComponentSlots(tag.getSrc(src), tag.ID)
 		if err != nil {
-			return src, err
+			return nil, nil, errorAt(err, src, m, tag.StartPos)
 		}
 
-		argStr := ""
-		for k, v := range tag.Attr {
-			if k == "type" {
-				continue
-			}
-			argStr += fmt.Sprintf(` "%s" "%s"`, k, v.Value)
+		cCount++
+		var (
+			cTpl  []byte
+			cFile string
+		)
+		if impl, found := tpl.component(tag.ID); found {
+			cTpl, cFile = registeredComponent(st, sx.delims, tag, slots, cCount, impl)
+		} else if cTpl, cFile, err = getComponentTemplate(st, sx.delims, tpl.fs, tag.ID, tplFolder, tpl.ext, tpl.strict); err != nil {
+			return nil, nil, newTemplateError(m.at(src, tag.StartPos), "%s", err)
 		}
-		if argStr != "" {
-			argStr = fmt.Sprintf("kwargs \"ctx\" . \"props\" (kwargs %s)", argStr)
-		} else {
-			argStr = "kwargs \"ctx\" ."
+
+		tagPos := m.at(src, tag.StartPos)
+		if err := componentCycle(tpl, tagPos, cFile); err != nil {
+			return nil, nil, err
 		}
 
-		cBlock := Document{}
-		cBlock.AppendString(
-			fmt.Sprintf("{{- $__args := (%s) -}}\n", argStr),
-			fmt.Sprintf("{{- block \"component__%s__%d\" $__args -}}\n", tag.ID, cCount),
-		)
+		// lines added around the component template are mapped to the component tag,
+		// the component template's lines are mapped to the component file
+		cMap := newSrcMap(cFile, cTpl, tagPos)
+		if cFile == "" {
+			cMap = srcMap{tagPos}.spread(cTpl)
+		}
 
-		cBlock.Append(cTpl, []byte("\n{{end -}}"))
+		// the front matter of a component isn't used
+		_, cTpl, cMap, err = extractYAMLFrontMatter(cTpl, cMap)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		slots, err := listComponentSlots(tag.getSrc(src), tag.ID)
+		schema, cTpl, cMap, err := extractProps(sx, cTpl, cMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		cTpl, cMap = sx.translatePush(cTpl, cMap)
+
+		props, err := tagProps(sx.delims, tag)
 		if err != nil {
-			return nil, err
+			return nil, nil, newTemplateError(tagPos, "component %s: %s", tag.ID, err)
+		}
+
+		// the attributes that aren't declared props are passed to {{ attrs }}
+		attrs := sx.usesAttrs(cTpl)
+		if attrs {
+			cTpl, cMap = sx.translateAttrs(cTpl, cMap)
+		}
+
+		argStr := "kwargs \"ctx\" ."
+		if schema != nil {
+			// declared props
+			declared, err := schema.args(props, attrs)
+			if err != nil {
+				return nil, nil, newTemplateError(tagPos, "component %s: %s", tag.ID, err)
+			}
+			argStr += fmt.Sprintf(" \"props\" (kwargs %s)", declared)
+			if attrs {
+				argStr += fmt.Sprintf(" \"attrs\" (kwargs %s)", propArgs(schema.undeclared(props)))
+			}
+		} else if len(props) > 0 {
+			argStr += fmt.Sprintf(" \"props\" (kwargs %s)", propArgs(props))
+			if attrs {
+				argStr += fmt.Sprintf(" \"attrs\" (kwargs %s)", propArgs(props))
+			}
 		}
-		actions, err := listActionSlots(cBlock)
+
+		// the slots filled by the tag are listed in .slots
+		if slotsUsedRe.Match(cTpl) {
+			cTpl, cMap = sx.translateHasSlot(cTpl, cMap)
+			argStr += fmt.Sprintf(" \"slots\" (kwargs%s)", filledSlots(tag, slots))
+		}
+
+		// an unclosed action would otherwise be closed by the end of the wrapping block
+		if _, err := listActionSlots(sx.actionTagRe, cTpl); err != nil {
+			return nil, nil, errorAt(err, cTpl, cMap, 0)
+		}
+
+		b := docBuilder{}
+		b.write([]byte(
+			sx.action("- $__args := (%s) -", argStr)+"\n"+
+				sx.action("- block \"component__%s__%d\" $__args -", tag.blockID(), cCount)+"\n",
+		), srcMap{tagPos, tagPos, tagPos})
+		b.write(cTpl, cMap)
+		b.write([]byte("\n"+sx.action("end -")), srcMap{tagPos, tagPos})
+		cBlock, cBlockMap := b.result()
+
+		actions, err := listActionSlots(sx.actionTagRe, cBlock)
 		if err != nil {
-			return nil, err
+			return nil, nil, errorAt(err, cBlock, cBlockMap, 0)
 		}
 
 		// substitute slot content
 		for _, slot := range slots {
 			action := popAction(&actions, "#slot--"+slot.Name)
 			if action == nil {
+				if tpl.strict {
+					return nil, nil, newTemplateError(m.at(src, tag.StartPos+slot.StartPos), "component %s has no slot %q", tag.ID, slot.Name)
+				}
 				continue
 			}
 
-			action, err := findAction(cBlock, "block", action.ID)
-			if err != nil || action == nil {
-				return nil, err
+			action, err := findAction(sx.actionTagRe, cBlock, "block", action.ID)
+			if err != nil {
+				return nil, nil, errorAt(err, cBlock, cBlockMap, 0)
+			}
+			if action == nil {
+				continue
+			}
+
+			scope := ""
+			if as, found := slot.Attr["as"]; found {
+				scope = as.Value
+				if !identRe.MatchString(scope) {
+					return nil, nil, newTemplateError(tagPos, "component %s: invalid name %q for the value of slot %s", tag.ID, scope, slot.Name)
+				}
 			}
 
-			swapContent(&cBlock, action, tag.ID, cCount, slot.Name, slot.Body, argStr)
+			bodyPos := tag.StartPos + slot.BodyPos
+			bodyMap := m.lines(src, bodyPos, bodyPos+len(slot.Body))
+			cBlock, cBlockMap = swapContent(sx.delims, cBlock, cBlockMap, action, tag.blockID(), cCount, slot.Name, slot.Body, scope, bodyMap)
 
 		}
 
 		// process unused slots
 		for _, a := range actions {
-			action, err := findAction(cBlock, "block", a.ID)
-			if err != nil || action == nil {
-				return nil, err
+			action, err := findAction(sx.actionTagRe, cBlock, "block", a.ID)
+			if err != nil {
+				return nil, nil, errorAt(err, cBlock, cBlockMap, 0)
+			}
+			if action == nil {
+				continue
 			}
 
 			if action.ID == "#slot--default" && len(slots) == 0 {
-				swapContent(&cBlock, action, tag.ID, cCount, "default", tag.Body, argStr)
+				bodyMap := m.lines(src, tag.BodyPos, tag.BodyPos+len(tag.Body))
+				cBlock, cBlockMap = swapContent(sx.delims, cBlock, cBlockMap, action, tag.blockID(), cCount, "default", tag.Body, "", bodyMap)
 				continue
 			}
 
-			swapContent(&cBlock, action, tag.ID, cCount, action.ID, "", argStr)
+			cBlock, cBlockMap = swapContent(sx.delims, cBlock, cBlockMap, action, tag.blockID(), cCount, action.ID, "", "", nil)
 		}
 
 		// replace tag in src
-		src.Replace(tag.getSrc(src), cBlock, 1)
+		src, m = splice(src, m, tag.StartPos, tag.EndPos, cBlock, cBlockMap)
+	}
+
+	return src, m, nil
+}
+
+// componentCycle returns an error if component file cFile is used (directly or not)
+// within its own template, such a component would be inlined forever.
+// pos is the position of the component's tag
+func componentCycle(xt *XTemplate, pos *srcPos, cFile string) error {
+	if cFile == "" {
+		return nil
+	}
+
+	var chain []string
+	for p := pos; p != nil; p = p.caller {
+		chain = append([]string{xt.relName(p.file)}, chain...)
 	}
 
-	return src, nil
+	cFile = xt.relName(cFile)
+	for i, f := range chain {
+		if f == cFile {
+			return fmt.Errorf("circular component: %s", strings.Join(append(chain[i:], cFile), " → "))
+		}
+	}
+
+	return nil
 }
 
 func tagInList(tags []Tag, tag *Tag) bool {
@@ -215,23 +418,78 @@ func tagInList(tags []Tag, tag *Tag) bool {
 	return false
 }
 
-func swapContent(cBlock *Document, action *Action, tagID string, cCount int, slotName, slotBody, props string) {
-	oldAction := (*cBlock)[action.StartPos:action.EndPos]
-	newAction := Document(oldAction)
+// swapContent renames the slot block action in cBlock and replaces its body
+// with slotBody (whose lines originate from bodyMap) if slotBody isn't empty.
+// the value passed to the slot is made available to slotBody as scope if scope isn't empty
+func swapContent(d delims, cBlock []byte, m srcMap, action *Action, tagID string, cCount int, slotName, slotBody, scope string, bodyMap srcMap) ([]byte, srcMap) {
 	// prefix slot block name with component id
 	if strings.HasPrefix(slotName, "#slot--") {
 		slotName = strings.TrimPrefix(slotName, "#slot--")
 	}
 	sn := fmt.Sprintf("%s__%d__%s", tagID, cCount, slotName)
-	newAction.Replace([]byte(action.ID), []byte(sn), 1)
+
+	bodyEnd := action.BodyPos + len(action.Body)
+	opening := bytes.Replace(cBlock[action.StartPos:action.BodyPos], []byte(action.ID), []byte(sn), 1)
+	if scope != "" && len(slotBody) > 0 {
+		opening = scopeSlot(d, opening, sn, scope)
+		slotBody = d.action(" $%s := .%s ", scope, scope) + slotBody
+	}
+
+	b := docBuilder{}
+	b.copy(cBlock, m, 0, action.StartPos)
+	b.replace(cBlock, m, action.StartPos, action.BodyPos, opening, nil)
 
 	// replace body
 	if len(slotBody) > 0 {
-		newAction.Replace([]byte(action.Body), []byte(slotBody), 1)
+		b.write([]byte(slotBody), bodyMap)
+	} else {
+		b.copy(cBlock, m, action.BodyPos, bodyEnd)
 	}
 
-	// replace template action
-	cBlock.Replace(oldAction, newAction, 1)
+	b.copy(cBlock, m, bodyEnd, len(cBlock))
+
+	return b.result()
+}
+
+// scopeSlot passes the component's arguments, with the slot's value added
+// as scope, to the slot block action opening
+// {{block "name" .item}} --> {{block "name" (slotScope $ "scope" (.item))}}
+func scopeSlot(d delims, opening []byte, name, scope string) []byte {
+	start := bytes.Index(opening, []byte(`"`+name+`"`)) + len(name) + 2
+	end := len(opening) - len(d.right)
+
+	pipe, trim := opening[start:end], ""
+	if bytes.HasSuffix(pipe, []byte(" -")) {
+		pipe, trim = pipe[:len(pipe)-2], " -"
+	}
+
+	retv := string(opening[:start])
+	retv += fmt.Sprintf(` (slotScope $ "%s" (%s))`, scope, bytes.TrimSpace(pipe))
+	return []byte(retv + trim + d.right)
+}
+
+// filledSlots returns the slots of tag, which have content, as kwargs arguments: "name1" true...
+// the content of a tag without slots fills the default slot
+func filledSlots(tag *Tag, slots []Tag) string {
+	retv := ""
+	for _, slot := range slots {
+		if strings.TrimSpace(slot.Body) != "" {
+			retv += fmt.Sprintf(" %q true", slot.Name)
+		}
+	}
+	if len(slots) == 0 && strings.TrimSpace(tag.Body) != "" {
+		retv += ` "default" true`
+	}
+
+	return retv
+}
+
+// translateHasSlot passes the component's arguments to hasSlot:
+// {{ if hasSlot "header" }} --> {{ if hasSlot $ "header" }}
+func (sx *syntax) translateHasSlot(src []byte, m srcMap) ([]byte, srcMap) {
+	return replaceAllFunc(sx.actionRe, src, m, func(b []byte) []byte {
+		return hasSlotRe.ReplaceAll(b, []byte("hasSlot $"))
+	})
 }
 
 func popAction(actions *[]Action, id string) *Action {
@@ -260,12 +518,21 @@ func findTag(src []byte, name string) (*Tag, error) {
 			continue
 		}
 
+		if name == tag.Element && tag.Type == SelfClosingTag && len(stack) == 0 {
+			tag.BodyPos = tag.EndPos
+			return &tag, nil
+		}
+
 		if name == tag.Element && tag.Type == ClosingTag {
 			var sTag Tag
+			if len(stack) == 0 {
+				return nil, &offsetError{tag.StartPos, "found closing tag without a coresponding opening tag"}
+			}
 			sTag, stack = stack[len(stack)-1], stack[:len(stack)-1]
 
 			if len(stack) == 0 {
 				sTag.Body = string(src[sTag.EndPos:tag.StartPos])
+				sTag.BodyPos = sTag.EndPos
 				sTag.EndPos = tag.EndPos
 
 				return &sTag, nil
@@ -274,7 +541,7 @@ func findTag(src []byte, name string) (*Tag, error) {
 	}
 	var err error
 	if len(stack) > 0 {
-		err = fmt.Errorf("cant find closing tag for:%s", name)
+		err = &offsetError{stack[len(stack)-1].StartPos, "cant find closing tag for:" + name}
 	}
 	return nil, err
 }
@@ -292,8 +559,17 @@ func listComponents(src []byte) ([]Tag, error) {
 			continue
 		}
 
+		if tag.Element == "component" && tag.Type == SelfClosingTag && tag.ID != "" {
+			tag.BodyPos = tag.EndPos
+			retv = append(retv, tag)
+			continue
+		}
+
 		if tag.Element == "component" && tag.Type == ClosingTag {
 			var sTag Tag
+			if len(stack) == 0 {
+				return nil, &offsetError{tag.StartPos, "found closing tag without a coresponding opening tag"}
+			}
 			sTag, stack = stack[len(stack)-1], stack[:len(stack)-1]
 			if sTag.ID == "" {
 				// malformed component: type attribute wasn't found
@@ -301,6 +577,7 @@ func listComponents(src []byte) ([]Tag, error) {
 			}
 
 			sTag.Body = string(src[sTag.EndPos:tag.StartPos])
+			sTag.BodyPos = sTag.EndPos
 			sTag.EndPos = tag.EndPos
 			retv = append(retv, sTag)
 		}
@@ -308,7 +585,7 @@ func listComponents(src []byte) ([]Tag, error) {
 
 	var err error
 	if len(stack) > 0 {
-		err = fmt.Errorf("cant find closing tag for component")
+		err = &offsetError{stack[len(stack)-1].StartPos, "cant find closing tag for component"}
 	}
 
 	return retv, err
@@ -337,12 +614,22 @@ func listComponentSlots(src []byte, id string) ([]Tag, error) {
 			continue
 		}
 
+		if tag.Element == "slot" && tag.Type == SelfClosingTag && len(stack) == 0 {
+			tag.BodyPos = tag.EndPos
+			retv = append(retv, tag)
+			continue
+		}
+
 		if tag.Element == "slot" && tag.Type == ClosingTag {
 			var sTag Tag
+			if len(stack) == 0 {
+				return nil, &offsetError{tag.StartPos, "found closing tag without a coresponding opening tag"}
+			}
 			sTag, stack = stack[len(stack)-1], stack[:len(stack)-1]
 
 			if len(stack) == 0 {
 				sTag.Body = string(src[sTag.EndPos:tag.StartPos])
+				sTag.BodyPos = sTag.EndPos
 				sTag.EndPos = tag.EndPos
 
 				retv = append(retv, sTag)
@@ -352,7 +639,7 @@ func listComponentSlots(src []byte, id string) ([]Tag, error) {
 
 	var err error
 	if len(stack) > 0 {
-		err = fmt.Errorf("cant find closing tag for:%s", id)
+		err = &offsetError{stack[len(stack)-1].StartPos, "cant find closing tag for:" + id}
 	}
 
 	return retv, err
@@ -369,20 +656,34 @@ func getTag(src []byte, location []int) Tag {
 
 	if src[tag.StartPos+1] == '/' {
 		tag.Type = ClosingTag
+	} else if location[6] < location[7] {
+		tag.Type = SelfClosingTag
+	}
+
+	// <x-card> is short for <component type="card">
+	tag.shorthand = strings.HasPrefix(tag.Element, "x-")
+	if tag.shorthand {
+		tag.Element, tag.ID = "component", tag.Element[2:]
 	}
 
-	if tag.Type == OpeningTag {
+	if tag.Type != ClosingTag {
 		tagSrc := src[tag.StartPos:tag.EndPos]
 		// log.Println(string(tagSrc))
 		groups := attrRe.FindAllSubmatchIndex(tagSrc, -1)
 		for _, g := range groups {
-			if len(g) > 5 {
+			if len(g) > 7 {
 				attrSrc := string(tagSrc[g[0]:g[1]])
 				key := string(tagSrc[g[2]:g[3]])
-				val := string(tagSrc[g[4]:g[5]])
+				val := ""
+				if g[4] >= 0 {
+					val = string(tagSrc[g[4]:g[5]])
+				} else if g[6] >= 0 {
+					val = string(tagSrc[g[6]:g[7]])
+				}
 				tag.Attr.Add(key, val, attrSrc)
+				tag.Attr[key].Bare = g[4] < 0 && g[6] < 0
 
-				if key == "type" {
+				if key == "type" && !tag.shorthand {
 					tag.ID = val
 				} else if key == "name" {
 					tag.Name = val
@@ -391,9 +692,19 @@ func getTag(src []byte, location []int) Tag {
 		}
 	}
 
+	if tag.Element == "component" {
+		tag.ID = componentName(tag.ID)
+	}
+
 	return tag
 }
 
+// componentName returns the path, within the components folder, of component name.
+// the folders of nested components are separated by dots or slashes: forms.input
+func componentName(name string) string {
+	return strings.ReplaceAll(name, ".", "/")
+}
+
 type actionType int
 
 const (
@@ -409,12 +720,13 @@ type Action struct {
 	StartPos int
 	EndPos   int
 	Body     string
+	BodyPos  int
 	Type     actionType
 }
 
-func findAction(src []byte, name, id string) (*Action, error) {
+func findAction(re *regexp.Regexp, src []byte, name, id string) (*Action, error) {
 	name = strings.ToLower(name)
-	actions := actionTagRe.FindAllSubmatchIndex(src, -1)
+	actions := re.FindAllSubmatchIndex(src, -1)
 	stack := make([]Action, 0)
 
 	for i := 0; i < len(actions); i++ {
@@ -428,13 +740,14 @@ func findAction(src []byte, name, id string) (*Action, error) {
 		if action.Type == ClosingAction {
 			var sAction Action
 			if len(stack) == 0 {
-				return nil, fmt.Errorf("found closing action without a coresponding opening action")
+				return nil, &offsetError{action.StartPos, "found closing action without a coresponding opening action"}
 			}
 
 			sAction, stack = stack[len(stack)-1], stack[:len(stack)-1]
 
 			if sAction.Name == name && sAction.ID == id {
 				sAction.Body = string(src[sAction.EndPos:action.StartPos])
+				sAction.BodyPos = sAction.EndPos
 				sAction.EndPos = action.EndPos
 
 				return &sAction, nil
@@ -444,16 +757,17 @@ func findAction(src []byte, name, id string) (*Action, error) {
 
 	var err error
 	if len(stack) > 0 {
-		err = fmt.Errorf("cant find closing action for:%s", name)
+		unclosed := stack[len(stack)-1]
+		err = &offsetError{unclosed.StartPos, "cant find closing action for:" + unclosed.Name}
 	}
 	return nil, err
 }
 
-func listActionSlots(src []byte) ([]Action, error) {
+func listActionSlots(re *regexp.Regexp, src []byte) ([]Action, error) {
 	name := "block"
 	slotPrefix := "#slot--"
 
-	actions := actionTagRe.FindAllSubmatchIndex(src, -1)
+	actions := re.FindAllSubmatchIndex(src, -1)
 	stack := make([]Action, 0)
 	slots := make([]Action, 0)
 
@@ -468,13 +782,14 @@ func listActionSlots(src []byte) ([]Action, error) {
 		if action.Type == ClosingAction {
 			var sAction Action
 			if len(stack) == 0 {
-				return nil, fmt.Errorf("found closing action without a coresponding opening action")
+				return nil, &offsetError{action.StartPos, "found closing action without a coresponding opening action"}
 			}
 
 			sAction, stack = stack[len(stack)-1], stack[:len(stack)-1]
 
 			if sAction.Name == name && strings.HasPrefix(sAction.ID, slotPrefix) {
 				sAction.Body = string(src[sAction.EndPos:action.StartPos])
+				sAction.BodyPos = sAction.EndPos
 				sAction.EndPos = action.EndPos
 
 				slots = append(slots, sAction)
@@ -485,7 +800,8 @@ func listActionSlots(src []byte) ([]Action, error) {
 
 	var err error
 	if len(stack) > 0 {
-		err = fmt.Errorf("cant find closing action for:%s", name)
+		unclosed := stack[len(stack)-1]
+		err = &offsetError{unclosed.StartPos, "cant find closing action for:" + unclosed.Name}
 	}
 	return slots, err
 }
@@ -515,23 +831,31 @@ func getAction(src []byte, location []int) Action {
 	return act
 }
 
-func getComponentTemplate(name, folder, ext string) (contents []byte, err error) {
+// getComponentTemplate returns the template of component name and its file name.
+// a placeholder template and an empty file name are returned if the component doesn't
+// exist, unless strict is set
+func getComponentTemplate(st *parseState, d delims, fsys fs.FS, name, folder, ext string, strict bool) (contents []byte, fleName string, err error) {
 	if len(ext) == 0 {
 		ext = "tmpl"
 	}
-	fleName := filepath.Join(folder, name+"."+ext)
-	contents, err = ioutil.ReadFile(fleName)
+	fleName = path.Join(folder, name+"."+ext)
+	contents, err = st.readFile(fsys, fleName)
 
 	if err != nil {
+		if strict {
+			return nil, "", fmt.Errorf("unknown component %q: %s not found", name, fleName)
+		}
 		contents = []byte(fmt.Sprintf(`
 <div>
-	{{block "#slot--unknown" .}}
+	%s
 		unknown component %s
-	{{end}}
+	%s
 </div>
-`, name))
-		return contents, nil
+`, d.action(`block "#slot--unknown" .`), name, d.action("end")))
+		return contents, "", nil
 	}
+
+	st.addSource(fleName, contents, nil, nil)
 	return
 }
 
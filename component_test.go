@@ -2,9 +2,12 @@ package xtemplate
 
 import (
 	"bytes"
+	"errors"
 	"testing"
+	"testing/fstest"
 
 	"github.com/andreyvit/diff"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_translateComponents(t *testing.T) {
@@ -209,7 +212,7 @@ func Test_translateComponents(t *testing.T) {
 	xt := New(Config{RootFolder: "./samples", Ext: "html"})
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src, err := translateComponents(xt, Document(tt.src))
+			src, _, err := translateComponents(xt, nil, Document(tt.src), nil)
 			if (err != nil) != tt.wantErr {
 				t.Fatal(err)
 			}
@@ -392,7 +395,7 @@ func Test_listActionSlots(t *testing.T) {
 </div> 
 `)
 
-	retv, err := listActionSlots(source)
+	retv, err := listActionSlots(defaultSyntax.actionTagRe, source)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -511,7 +514,7 @@ func Test_findAction(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c, err := findAction(source, tt.tag, tt.id)
+			c, err := findAction(defaultSyntax.actionTagRe, source, tt.tag, tt.id)
 			if tt.wantErr && err == nil {
 				t.Fatalf("want error but got %s", c.Name)
 			}
@@ -528,3 +531,132 @@ func Test_findAction(t *testing.T) {
 		})
 	}
 }
+
+func Test_scopedSlots(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/table.html": {Data: []byte(`<table>{{range .ctx.items}}<tr>{{block "#slot--row" .}}<td>{{.}}</td>{{end}}</tr>{{end}}</table>`)},
+		"views/_components/list.html": {Data: []byte(`<ul>{{range $i, $v := .ctx.items}}{{block "#slot--item" (kwargs "index" $i "value" $v) -}}
+	<li>{{.value}}</li>{{end}}{{end}}</ul>`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{"name": "dinma", "items": []string{"a", "b"}}
+
+	tests := []renderCase{
+		{
+			name:     "scoped",
+			src:      `<component type="table"><slot name="row" as="item"><td>{{ $item }}/{{ .item }}/{{ .ctx.name }}</td></slot></component>`,
+			expected: "<table><tr><td>a/a/dinma</td></tr><tr><td>b/b/dinma</td></tr></table>\n",
+		},
+		{
+			name:     "unscoped",
+			src:      `<component type="table"><slot name="row"><td>[{{ . }}]</td></slot></component>`,
+			expected: "<table><tr><td>[a]</td></tr><tr><td>[b]</td></tr></table>\n",
+		},
+		{
+			name:     "default",
+			src:      `<component type="table"></component>`,
+			expected: "<table><tr><td>a</td></tr><tr><td>b</td></tr></table>\n",
+		},
+		{
+			name:     "pipeline",
+			src:      `<component type="list"><slot name="item" as="it"><li>{{ $it.index }}:{{ .it.value }}</li></slot></component>`,
+			expected: "<ul><li>0:a</li><li>1:b</li></ul>\n",
+		},
+		{
+			name:    "invalid name",
+			src:     `<component type="table"><slot name="row" as="my-item"></slot></component>`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+
+	_, err := xt.RenderString("\n<component type=\"table\"><slot name=\"row\" as=\"my-item\"></slot></component>", data)
+	var tErr *TemplateError
+	if assert.True(t, errors.As(err, &tErr), "%v", err) {
+		assert.Equal(t, 2, tErr.Line)
+	}
+}
+
+func Test_componentTags(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/card.html":        {Data: []byte(`<div>{{ .props.title }}:{{block "#slot--default" .}}empty{{end}}</div>`)},
+		"views/_components/forms/input.html": {Data: []byte(`<input name="{{ .props.name }}">{{block "#slot--hint" .}}{{end}}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"}).
+		RegisterComponent("forms.badge", `<b>{{ .props.label }}</b>`)
+
+	tests := []renderCase{
+		{
+			name:     "self closing",
+			src:      `<component type="card" title="a" /><component type="card" title="b"/>`,
+			expected: "<div>a:empty</div>\n<div>b:empty</div>\n",
+		},
+		{
+			name:     "shorthand",
+			src:      `<x-card title="Hi">body</x-card>`,
+			expected: "<div>Hi:body</div>\n",
+		},
+		{
+			name:     "nested shorthand",
+			src:      "<x-card title=\"a\">\n<x-card title=\"b\" />\n</x-card>",
+			expected: "<div>a:<div>b:empty</div>\n</div>\n",
+		},
+		{
+			name:     "framework attributes",
+			src:      `<x-card title="Hi" @click="open = true" v-on:click.prevent='go()'>body</x-card>`,
+			expected: "<div>Hi:body</div>\n",
+		},
+		{
+			name:     "dotted",
+			src:      `<x-forms.input name="email"><slot name="hint"><x-forms.badge label="!" /></slot></x-forms.input>`,
+			expected: "<input name=\"email\"><b>!</b>\n\n",
+		},
+		{
+			name:     "slashed",
+			src:      `<component type="forms/input" name="email"><slot name="hint"/></component>`,
+			expected: "<input name=\"email\">\n",
+		},
+	}
+
+	renderCases(t, xt, nil, tests)
+}
+
+func Test_hasSlot(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/card.html": {Data: []byte(`<div>
+{{- if hasSlot "header" }}<h1>{{block "#slot--header" .}}{{end}}</h1>{{ end -}}
+{{- range .ctx.items }}{{ if $.slots.footer }}[{{ . }}]{{ end }}{{ end -}}
+{{- if hasSlot "footer" }}<footer>{{block "#slot--footer" .}}{{end}}</footer>{{ end -}}
+</div>`)},
+		"views/_components/box.html": {Data: []byte(`{{ if .slots.default }}<div>{{block "#slot--default" .}}{{end}}</div>{{ end }}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{"items": []int{1, 2}}
+
+	tests := []renderCase{
+		{
+			name:     "filled",
+			src:      `<x-card><slot name="header">Hi</slot><slot name="footer">end</slot></x-card>`,
+			expected: "<div><h1>Hi</h1>[1][2]<footer>end</footer></div>\n",
+		},
+		{
+			name:     "empty",
+			src:      `<x-card><slot name="header"> </slot><slot name="footer" /></x-card>`,
+			expected: "<div></div>\n",
+		},
+		{
+			name:     "default",
+			src:      `<x-box>content</x-box><x-box> </x-box>`,
+			expected: "<div>content</div>\n\n",
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+}
@@ -0,0 +1,174 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"io"
+	"reflect"
+)
+
+/*
+	functions whose first parameter is a context.Context receive the context of the render,
+	the context parameter is omitted when calling the function from a template
+
+	xt.AddFunc("t", func(ctx context.Context, key string) string {...})
+	{{ t "hello" }}
+
+	templates rendered without a context (Render, RenderString...) pass context.Background()
+*/
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// takesContext reports whether fn is a function whose first parameter is a context.Context
+func takesContext(fn interface{}) bool {
+	typ := reflect.TypeOf(fn)
+	return typ != nil && typ.Kind() == reflect.Func && typ.NumIn() > 0 && typ.In(0) == contextType
+}
+
+// bindContext returns a function that calls fn with ctx as its first argument.
+// the function fails with the context's error once ctx is done
+func bindContext(ctx context.Context, fn interface{}) interface{} {
+	fv := reflect.ValueOf(fn)
+	typ := fv.Type()
+
+	in := make([]reflect.Type, typ.NumIn()-1)
+	for i := range in {
+		in[i] = typ.In(i + 1)
+	}
+	out := make([]reflect.Type, typ.NumOut())
+	for i := range out {
+		out[i] = typ.Out(i)
+	}
+
+	bound := reflect.FuncOf(in, out, typ.IsVariadic())
+	return reflect.MakeFunc(bound, func(args []reflect.Value) []reflect.Value {
+		if err := ctx.Err(); err != nil {
+			if len(out) == 0 || out[len(out)-1] != errorType {
+				// text/template reports the panic as an error calling the function
+				panic(err)
+			}
+
+			retv := make([]reflect.Value, len(out))
+			for i := range out {
+				retv[i] = reflect.Zero(out[i])
+			}
+			retv[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return retv
+		}
+
+		args = append([]reflect.Value{reflect.ValueOf(ctx)}, args...)
+		if typ.IsVariadic() {
+			return fv.CallSlice(args)
+		}
+		return fv.Call(args)
+	}).Interface()
+}
+
+// contextFuncs returns the functions of funcs that take a context bound to ctx
+func contextFuncs(ctx context.Context, funcs template.FuncMap) template.FuncMap {
+	retv := template.FuncMap{}
+	for name, fn := range funcs {
+		if takesContext(fn) {
+			retv[name] = bindContext(ctx, fn)
+		}
+	}
+
+	return retv
+}
+
+// hasContextFuncs reports whether any registered function takes a context
+func (s *XTemplate) hasContextFuncs() bool {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	for _, fn := range s.funcs {
+		if takesContext(fn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contextFuncs returns the registered functions that take a context bound to ctx
+func (s *XTemplate) contextFuncs(ctx context.Context) template.FuncMap {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	return contextFuncs(ctx, s.funcs)
+}
+
+// bind returns the template of entry with its functions bound to ctx.
+// executed templates can't be cloned, so a copy of entry's unexecuted
+// template is made when ctx is used by any function
+func (s *XTemplate) bind(ctx context.Context, entry *cacheEntry) (*template.Template, error) {
+	if entry.proto == nil || ctx == context.Background() {
+		return entry.tpl, nil
+	}
+
+	tpl, err := entry.proto.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bindComponents(ctx, tpl.Funcs(s.contextFuncs(ctx))), nil
+}
+
+// execute executes block, or the template itself if block is empty, of entry.
+// execution stops with ctx's error when ctx is done
+func (s *XTemplate) execute(ctx context.Context, entry *cacheEntry, wr io.Writer, block string, data interface{}) error {
+	tpl, err := s.bind(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Done() != nil {
+		wr = &ctxWriter{ctx: ctx, w: wr}
+	}
+
+	data = withMeta(entry.meta, data)
+
+	out := wr
+	buf := bytes.NewBufferString("")
+	if entry.stacks {
+		// pushed content is moved to its stack once the template is executed
+		out = buf
+		if ctx.Done() != nil {
+			out = &ctxWriter{ctx: ctx, w: buf}
+		}
+	}
+
+	if block == "" {
+		err = tpl.Execute(out, data)
+	} else {
+		err = tpl.ExecuteTemplate(out, block, data)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return entry.src.wrap(err)
+	}
+
+	if entry.stacks {
+		_, err = wr.Write(resolveStacks(buf.Bytes()))
+	}
+
+	return err
+}
+
+// ctxWriter fails writes once its context is done
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return w.w.Write(p)
+}
@@ -0,0 +1,120 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey string
+
+func localeFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"locale": func(ctx context.Context) string {
+			if l, ok := ctx.Value(ctxKey("locale")).(string); ok {
+				return l
+			}
+			return "en"
+		},
+		"greet": func(ctx context.Context, name string, extra ...string) (string, error) {
+			return fmt.Sprintf("%v %s%s", ctx.Value(ctxKey("locale")), name, strings.Join(extra, "")), nil
+		},
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/master.html": {Data: []byte(`<html lang="{{ locale }}">{{block "body" .}}{{end}}</html>`)},
+		"views/page.html":   {Data: []byte(`{{extends "master.html"}}{{define "body"}}{{ greet(.name, "!") }}{{end}}`)},
+		"views/loop.html":   {Data: []byte(`{{range .items}}{{.}}{{end}}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views", Ext: "html", Funcs: localeFuncs()})
+	data := map[string]interface{}{"name": "dinma"}
+
+	// templates rendered without a context receive context.Background()
+	buff := bytes.NewBufferString("")
+	assert.NoError(t, xt.Render(buff, "page", data, false))
+	assert.Equal(t, `<html lang="en">&lt;nil&gt; dinma!</html>`, buff.String())
+
+	var wg sync.WaitGroup
+	for _, l := range []string{"fr", "de", "ig", "yo"} {
+		wg.Add(1)
+		go func(l string) {
+			defer wg.Done()
+
+			ctx := context.WithValue(context.Background(), ctxKey("locale"), l)
+			buff := bytes.NewBufferString("")
+			assert.NoError(t, xt.RenderContext(ctx, buff, "page", data))
+			assert.Equal(t, fmt.Sprintf(`<html lang="%s">%s dinma!</html>`, l, l), buff.String())
+
+			buff.Reset()
+			assert.NoError(t, xt.RenderBlockContext(ctx, buff, "page", "body", data))
+			assert.Equal(t, l+" dinma!", buff.String())
+		}(l)
+	}
+	wg.Wait()
+
+	ctx := context.WithValue(context.Background(), ctxKey("locale"), "fr")
+	retv, err := xt.RenderStringContext(ctx, `{{ locale }}:{{ greet "x" }}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "fr:fr x", retv)
+
+	// cancelled contexts stop execution
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	buff.Reset()
+	err = xt.RenderContext(ctx, buff, "loop", map[string]interface{}{"items": []int{1, 2, 3}})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "", buff.String())
+
+	_, err = xt.RenderStringContext(ctx, `{{ greet "x" }}`, nil)
+	assert.Equal(t, context.Canceled, err)
+
+	// including templates using stacks
+	ctx, cancel = context.WithCancel(context.Background())
+	ticks := 0
+	xt = New(Config{FS: fstest.MapFS{}, Funcs: map[string]interface{}{
+		"tick": func() int {
+			if ticks++; ticks == 3 {
+				cancel()
+			}
+			return ticks
+		},
+	}})
+
+	_, err = xt.RenderStringContext(ctx, `{{ stack "scripts" }}{{ range .items }}{{ tick }}{{ end }}`,
+		map[string]interface{}{"items": make([]int, 1000)})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3, ticks)
+}
+
+func Test_bindContext(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey("locale"), "fr"))
+
+	fn := bindContext(ctx, localeFuncs()["greet"]).(func(string, ...string) (string, error))
+	retv, err := fn("a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, "fr abc", retv)
+
+	locale := bindContext(ctx, localeFuncs()["locale"]).(func() string)
+	assert.Equal(t, "fr", locale())
+
+	cancel()
+	_, err = fn("a")
+	assert.Equal(t, context.Canceled, err)
+	assert.Panics(t, func() { locale() })
+
+	assert.False(t, takesContext(upper))
+	assert.False(t, takesContext("upper"))
+	assert.True(t, takesContext(localeFuncs()["locale"]))
+}
@@ -0,0 +1,86 @@
+package xtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// syntax holds the action delimiters and the
+// preprocessor expressions built from them
+type syntax struct {
+	delims
+
+	// {{ extend "index.html" }}
+	actRe *regexp.Regexp
+	// {{ template button(123) }}
+	tplRe *regexp.Regexp
+	// {{template "tplName"}}
+	// {{template "tplName" . }}
+	// {{template "tplName" $ }}
+	tplRe2 *regexp.Regexp
+	// {{block "name" .}}, {{end}}...
+	actionTagRe *regexp.Regexp
+	// {{ props }} ... {{ end }} at the start of a component template
+	propsRe *regexp.Regexp
+	// {{ push "styles" }}
+	pushRe *regexp.Regexp
+	// {{ if push (a translated push) or {{ stack
+	stacksRe *regexp.Regexp
+	// {{ attrs
+	attrsRe *regexp.Regexp
+	// {{ include "name" with .Data only }}
+	includeRe *regexp.Regexp
+	// {{ import "forms.html" as f }}
+	importRe *regexp.Regexp
+	// {{ defmacro button(label, kind="primary") }}
+	defmacroRe *regexp.Regexp
+	// {{ call panel("title") }}
+	callRe *regexp.Regexp
+	// any action
+	actionRe *regexp.Regexp
+}
+
+var defaultSyntax = newSyntax(defaultDelims.left, defaultDelims.right)
+
+func newSyntax(left, right string) *syntax {
+	l, r := regexp.QuoteMeta(left), regexp.QuoteMeta(right)
+	re := func(format string) *regexp.Regexp {
+		return regexp.MustCompile(fmt.Sprintf(format, l, r))
+	}
+
+	return &syntax{
+		delims:      delims{left: left, right: right},
+		actRe:       re(`\-*[[:blank:]]*%s *(.+?) *\"(.+?)\" *%s[[:blank:]]*[\r\n]*\-*`),
+		tplRe:       re(`%s\-*\s*(macro|template)\s*([a-zA-Z0-9\-_.]+)\s*\((.*?)\)\s*\-*%s`),
+		tplRe2:      re(`%s\-*\s*template\s+"([\w/_.]+)"\s*([.$\w\s_"]*)\s*\-*%s`),
+		actionTagRe: re(`%s-*\s*([\w]+)\s?([\s\w"-.$:=]*?)\s*-*%s`),
+		propsRe:     re(`(?s)^\s*%[1]s-?\s*props\s*-?%[2]s(.*?)%[1]s-?\s*end\s*-?%[2]s[ \t]*\r?\n?`),
+		pushRe:      re(`%s(-?\s*)push(\s+.*?)%s`),
+		stacksRe:    re(`%[1]s-?\s*(?:if\s+push|stack)\s`),
+		attrsRe:     re(`%[1]s-?\s*attrs\b`),
+		includeRe:   re(`%s(-?)\s*include\s+((?:"[^"]*"[\s,]*)+|\[[^\]]*\])(.*?)(-?)%s`),
+		importRe:    re(`%s-?\s*import\s+"([^"]+)"\s+as\s+([a-zA-Z_]\w*)\s*-?%s[ \t]*\r?\n?`),
+		defmacroRe:  re(`%s(-?)\s*defmacro\s+([a-zA-Z0-9\-_]+)\s*\(((?:[^()"]|"[^"]*")*)\)\s*(-?)%s`),
+		callRe:      re(`%s(-?)\s*call\s+([a-zA-Z_][\w.\-]*)\(((?:[^()"]|"[^"]*"|\([^()]*\))*)\)\s*(-?)%s`),
+		actionRe:    re(`(?s)%s.*?%s`),
+	}
+}
+
+// action returns an action, with the delimiters, whose content is format
+// formatted with args
+func (d delims) action(format string, args ...interface{}) string {
+	return d.left + fmt.Sprintf(format, args...) + d.right
+}
+
+// unwrap returns the content of s if s is a single action: {{ .Name }} --> .Name
+func (d delims) unwrap(s string) string {
+	t := strings.TrimSpace(s)
+	if !strings.HasPrefix(t, d.left) || !strings.HasSuffix(t, d.right) || len(t) < len(d.left)+len(d.right) {
+		return s
+	}
+
+	t = strings.TrimSpace(t[len(d.left) : len(t)-len(d.right)])
+	t = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(t, "- "), " -"))
+	return t
+}
@@ -0,0 +1,88 @@
+package xtemplate
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// delimsFS returns the samples folder with {{ }} replaced by left and right
+func delimsFS(t *testing.T, left, right string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	err := fs.WalkDir(os.DirFS("."), "samples", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		b = bytes.ReplaceAll(bytes.ReplaceAll(b, []byte("{{"), []byte(left)), []byte("}}"), []byte(right))
+		fsys[name] = &fstest.MapFile{Data: b}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fsys
+}
+
+func TestDelims(t *testing.T) {
+
+	// masters that can't be rendered on their own
+	failing := []string{"base.html"}
+
+	data := map[string]interface{}{
+		"name": "dinma", "age": 18,
+	}
+
+	for _, delims := range [][2]string{{"[[", "]]"}, {"<%", "%>"}} {
+		fsys := delimsFS(t, delims[0], delims[1])
+
+		for _, ext := range []string{"html", "tmpl"} {
+			xt := New(Config{FS: os.DirFS("."), RootFolder: "samples", Ext: ext})
+			alt := New(Config{FS: fsys, RootFolder: "samples", Ext: ext}).Delims(delims[0], delims[1])
+
+			for name := range fsys {
+				name = strings.TrimPrefix(name, "samples/")
+				// the attributes of tags are rendered in random order
+				if path.Ext(name) != "."+ext || strings.HasPrefix(name, "_") || name == "tags.html" {
+					continue
+				}
+
+				t.Run(delims[0]+" "+name, func(t *testing.T) {
+					want := bytes.NewBufferString("")
+					wantErr := xt.Render(want, name, data, false)
+					got := bytes.NewBufferString("")
+					err := alt.Render(got, name, data, false)
+
+					if StrListIncludes(name, failing) {
+						if assert.Error(t, wantErr) && assert.Error(t, err) {
+							assert.Equal(t, wantErr.Error(), err.Error())
+						}
+						return
+					}
+
+					assert.NoError(t, wantErr)
+					assert.NoError(t, err)
+					assert.Equal(t, want.String(), got.String())
+				})
+			}
+		}
+	}
+
+	// the default delimiters are plain text
+	xt := New(Config{FS: fstest.MapFS{}}).Delims("[[", "]]")
+	retv, err := xt.RenderString(`[[ upper(.name) ]] {{ .name }}`, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "DINMA {{ .name }}", retv)
+}
@@ -0,0 +1,85 @@
+package xtemplate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError records the failure to parse a template
+type ParseError struct {
+	// Name is the name of the template
+	Name string
+	// File is the path of the template file
+	File string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors lists the templates that failed to parse
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	if len(e) == 1 {
+		lines = append(lines, "1 template failed to parse:")
+	} else {
+		lines = append(lines, fmt.Sprintf("%d templates failed to parse:", len(e)))
+	}
+
+	for _, err := range e {
+		lines = append(lines, "\t"+err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Position is a location in a template file
+type Position struct {
+	File string
+	Line int
+	// Col is the column starting from 1, 0 when it isn't known
+	Col int
+}
+
+func (p Position) String() string {
+	if p.Col > 0 {
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+	}
+
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// TemplateError is a parse or execution error reported
+// against the original source of a template
+type TemplateError struct {
+	// Name is the name the file was parsed under
+	Name string
+	// Position is where the error occurred
+	Position
+	// Callers lists the component tags, innermost first, when the
+	// error occurred within a component template
+	Callers []Position
+	// Description is the error message without its location
+	Description string
+	Err         error
+}
+
+func (e *TemplateError) Error() string {
+	msg := fmt.Sprintf("template: %s: %s", e.Position, e.Description)
+	for _, c := range e.Callers {
+		msg += fmt.Sprintf(" [component used at %s]", c)
+	}
+
+	return msg
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,78 @@
+package xtemplate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateError(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/master.html": {Data: []byte("<h1>{{block \"title\" .}}{{end}}</h1>\n<p>{{ index .list 5 }}</p>")},
+		"views/page.html":   {Data: []byte("{{extends \"master.html\"}}\n{{define \"title\"}}\n{{ upper(.name) }}{{end}}")},
+		"views/parse.html":  {Data: []byte("<p>\n{{ .name }}\n{{ .name }\n</p>")},
+		"views/exec.html": {Data: []byte(`<component type="card">
+	{{.ctx.name}}
+</component>
+<p>
+	{{ .name }} {{ index .list 5 }}
+</p>`)},
+		"views/used.html": {Data: []byte(`<p>{{.name}}</p>
+
+<component type="broken" title="x">body</component>`)},
+		"views/slot.html":               {Data: []byte("<p>\n<component type=\"card\">\n\t<slot name=\"default\">x\n</component>")},
+		"views/if.html":                 {Data: []byte("<p>\n\n<component type=\"open\"></component>")},
+		"views/stray.html":              {Data: []byte("<component type=\"card\"></component>\n<p>\n</component>")},
+		"views/_components/card.html":   {Data: []byte(`<div class="card">{{block "#slot--default" .}}{{end}}</div>`)},
+		"views/_components/broken.html": {Data: []byte("<div>\n\t{{ index .ctx.list 5 }}\n</div>")},
+		"views/_components/open.html":   {Data: []byte("<div>\n{{ if .ctx }}\n</div>")},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views", Ext: "html"})
+	data := map[string]interface{}{"name": "dinma", "list": []int{1}}
+
+	tests := []struct {
+		name    string
+		tpl     string
+		pos     Position
+		callers []Position
+	}{
+		{name: "parse", tpl: "parse", pos: Position{File: "views/parse.html", Line: 3}},
+		{name: "exec", tpl: "exec", pos: Position{File: "views/exec.html", Line: 5, Col: 17}},
+		{name: "master", tpl: "page", pos: Position{File: "views/master.html", Line: 2, Col: 7}},
+		{
+			name: "component", tpl: "used",
+			pos:     Position{File: "views/_components/broken.html", Line: 2, Col: 5},
+			callers: []Position{{File: "views/used.html", Line: 3}},
+		},
+		// the components and their slots must be closed
+		{name: "unclosed slot", tpl: "slot", pos: Position{File: "views/slot.html", Line: 3}},
+		{
+			name: "unclosed action", tpl: "if",
+			pos:     Position{File: "views/_components/open.html", Line: 2},
+			callers: []Position{{File: "views/if.html", Line: 3}},
+		},
+		{name: "stray closing tag", tpl: "stray", pos: Position{File: "views/stray.html", Line: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := xt.Render(bytes.NewBufferString(""), tt.tpl, data, false)
+
+			var tErr *TemplateError
+			if !assert.True(t, errors.As(err, &tErr), "%v", err) {
+				return
+			}
+			assert.Equal(t, tt.pos, tErr.Position)
+			assert.Equal(t, tt.callers, tErr.Callers)
+			assert.NotNil(t, errors.Unwrap(tErr))
+		})
+	}
+
+	_, err := xt.RenderString("<p>\n\t{{ index .list 5 }}</p>", data)
+	assert.Regexp(t, `^template: <string>:2:5: executing .* at <index .list 5>: error calling index: index out of range: 5$`, err)
+}
@@ -49,6 +49,24 @@ func kwargs(arg ...interface{}) map[string]interface{} {
 	return m
 }
 
+// slotScope returns the arguments of a component (ctx, props...) with
+// value, the value passed to a scoped slot, added under name
+func slotScope(args map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	scope := make(map[string]interface{}, len(args)+1)
+	for k, v := range args {
+		scope[k] = v
+	}
+	scope[name] = value
+
+	return scope
+}
+
+// hasSlot reports whether slot name of a component, whose arguments are args, has content
+func hasSlot(args map[string]interface{}, name string) bool {
+	slots, _ := args["slots"].(map[string]interface{})
+	return slots[name] == true
+}
+
 // tags a default/reference implementation which supports the <tag></tag> feature
 func tags(typ string, attr map[string]interface{}, content string) template.HTML {
 
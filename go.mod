@@ -9,5 +9,5 @@ require (
 	github.com/stretchr/testify v1.5.1
 	github.com/valyala/fasttemplate v1.2.1
 	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
-	gopkg.in/yaml.v2 v2.2.8 // indirect
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,46 @@
+package xtemplate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// renderCase is a template rendered with RenderString and its expected output
+type renderCase struct {
+	name     string
+	src      string
+	expected string
+	// wantErr expects any error, err the description of a *TemplateError
+	wantErr bool
+	err     string
+}
+
+// renderCases renders the src of each case with data as a subtest named after the case, or its src
+func renderCases(t *testing.T, xt *XTemplate, data interface{}, cases []renderCase) {
+	t.Helper()
+
+	for _, tt := range cases {
+		name := tt.name
+		if name == "" {
+			name = tt.src
+		}
+
+		t.Run(name, func(t *testing.T) {
+			retv, err := xt.RenderString(tt.src, data)
+			switch {
+			case tt.err != "":
+				var tErr *TemplateError
+				if assert.True(t, errors.As(err, &tErr), "%v", err) {
+					assert.Equal(t, tt.err, tErr.Description)
+				}
+			case tt.wantErr:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, retv)
+			}
+		})
+	}
+}
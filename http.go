@@ -0,0 +1,45 @@
+package xtemplate
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// IsFragmentRequest reports whether r asks for part of a page. i.e it was sent by htmx
+// (excluding boosted and history restore requests, which expect a full page) or by a Turbo frame
+func IsFragmentRequest(r *http.Request) bool {
+	if r.Header.Get("Turbo-Frame") != "" {
+		return true
+	}
+
+	return r.Header.Get("HX-Request") == "true" &&
+		r.Header.Get("HX-Boosted") != "true" &&
+		r.Header.Get("HX-History-Restore-Request") != "true"
+}
+
+// RenderRequest writes the named block of template name to w when r is a fragment
+// request (see IsFragmentRequest) and the complete template otherwise. the request's
+// context is used for rendering. nothing is written to w if rendering fails
+func (s *XTemplate) RenderRequest(w http.ResponseWriter, r *http.Request, name, block string, data interface{}) error {
+	buff := bytes.NewBufferString("")
+
+	var err error
+	if IsFragmentRequest(r) {
+		err = s.RenderBlockContext(r.Context(), buff, name, block, data)
+	} else {
+		err = s.RenderContext(r.Context(), buff, name, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	// responses differ based on these headers
+	w.Header().Add("Vary", "HX-Request")
+	w.Header().Add("Vary", "Turbo-Frame")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	_, err = buff.WriteTo(w)
+	return err
+}
@@ -0,0 +1,91 @@
+package xtemplate
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fragmentFS = fstest.MapFS{
+	"views/master.html": {Data: []byte(`<h1>{{block "title" .}}master{{end}}</h1>{{block "list" .}}{{end}}`)},
+	"views/page.html": {Data: []byte(`{{extends "master.html"}}{{include "items.html"}}
+{{define "title"}}{{.name}}{{end}}
+{{define "list"}}<ul>{{range .items}}{{template "item" .}}{{end}}</ul>{{end}}`)},
+	"views/items.html": {Data: []byte(`{{define "item"}}<li>{{.}}</li>{{end}}`)},
+}
+
+func TestRenderBlock(t *testing.T) {
+
+	xt := New(Config{FS: fragmentFS, RootFolder: "views", Ext: "html"})
+	data := map[string]interface{}{"name": "dinma", "items": []string{"a", "b"}}
+
+	tests := []struct {
+		name     string
+		block    string
+		expected string
+		wantErr  bool
+	}{
+		{name: "block", block: "list", expected: "<ul><li>a</li><li>b</li></ul>"},
+		{name: "overridden", block: "title", expected: "dinma"},
+		{name: "include", block: "item", expected: "<li>map[items:[a b] name:dinma]</li>"},
+		{name: "missing", block: "none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := bytes.NewBufferString("")
+			err := xt.RenderBlock(buff, "page", tt.block, data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, buff.String())
+		})
+	}
+
+	// the block is rendered from the cached template
+	buff := bytes.NewBufferString("")
+	assert.NoError(t, xt.Render(buff, "page", data, false))
+	assert.Equal(t, "<h1>dinma</h1><ul><li>a</li><li>b</li></ul>", buff.String())
+}
+
+func TestRenderRequest(t *testing.T) {
+
+	xt := New(Config{FS: fragmentFS, RootFolder: "views", Ext: "html"})
+	data := map[string]interface{}{"name": "dinma", "items": []string{"a"}}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected string
+	}{
+		{name: "page", expected: "<h1>dinma</h1><ul><li>a</li></ul>"},
+		{name: "htmx", headers: map[string]string{"HX-Request": "true"}, expected: "<ul><li>a</li></ul>"},
+		{name: "boosted", headers: map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, expected: "<h1>dinma</h1><ul><li>a</li></ul>"},
+		{name: "turbo", headers: map[string]string{"Turbo-Frame": "list"}, expected: "<ul><li>a</li></ul>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			assert.NoError(t, xt.RenderRequest(w, r, "page", "list", data))
+			assert.Equal(t, tt.expected, w.Body.String())
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, []string{"HX-Request", "Turbo-Frame"}, w.Header()["Vary"])
+		})
+	}
+
+	w := httptest.NewRecorder()
+	assert.Error(t, xt.RenderRequest(w, httptest.NewRequest("GET", "/", nil), "none", "list", data))
+	assert.Equal(t, 0, w.Body.Len())
+}
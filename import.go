@@ -0,0 +1,217 @@
+package xtemplate
+
+import (
+	"html/template"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+/*
+	{{ import "forms.html" as f }} makes the templates defined by forms.html available
+	to the file under the f namespace
+
+	{{ import "forms.html" as f }}
+	{{ macro f.input("email") }} --> {{ template "forms.html#input" "email" }}
+
+	the templates of an imported file are added under a private name (file#name) so
+	libraries defining the same names don't clash. the templates of the library calling
+	each other keep calling the library's version.
+	an import reusing the namespace of another import or hiding a template named
+	namespace.name is reported as a warning, see Config.Warn
+*/
+
+// templateImport is an {{ import "file" as alias }} action at pos
+type templateImport struct {
+	file  string
+	alias string
+	pos   *srcPos
+}
+
+// importedName returns the private name of template name of the imported file
+func importedName(file, name string) string {
+	return file + "#" + name
+}
+
+// translateImports removes the import actions of src and returns the files
+// imported by namespace
+func translateImports(xt *XTemplate, st *parseState, src []byte, m srcMap) (map[string]string, []byte, srcMap, error) {
+	sx := xt.syntax()
+	locs := sx.importRe.FindAllSubmatchIndex(src, -1)
+	if locs == nil {
+		return nil, src, m, nil
+	}
+
+	m = m.ensure(src)
+	imports := map[string]string{}
+	b := docBuilder{}
+	pos := 0
+	for _, loc := range locs {
+		name, alias := string(src[loc[2]:loc[3]]), string(src[loc[4]:loc[5]])
+		at := m.at(src, loc[0])
+
+		fle, found := xt.findFile(st, name)
+		if !found {
+			return nil, nil, nil, newTemplateError(at, "import: no file or partial named %q", name)
+		}
+		file := xt.relName(fle)
+
+		if prev, found := imports[alias]; found && prev != file {
+			xt.warn(newTemplateError(at, "import %q as %s shadows the import of %q", name, alias, prev))
+		}
+		imports[alias] = file
+		st.imports = append(st.imports, templateImport{file: file, alias: alias, pos: at})
+
+		b.copy(src, m, pos, loc[0])
+		b.replace(src, m, loc[0], loc[1], nil, nil)
+		pos = loc[1]
+	}
+	b.copy(src, m, pos, len(src))
+
+	src, m = b.result()
+	return imports, src, m, nil
+}
+
+// parseImports adds the templates of the files imported while parsing tpl to tpl
+func (s *XTemplate) parseImports(st *parseState, tpl *template.Template) error {
+	parsed := map[string]map[string]bool{}
+	for i := 0; i < len(st.imports); i++ {
+		imp := st.imports[i]
+		names, found := parsed[imp.file]
+		if !found {
+			var err error
+			if names, err = s.parseImport(st, tpl, imp.file); err != nil {
+				return err
+			}
+			parsed[imp.file] = names
+		}
+
+		for name := range names {
+			if tpl.Lookup(imp.alias+"."+name) != nil {
+				s.warn(newTemplateError(imp.pos, "import %q as %s shadows template %q", imp.file, imp.alias, imp.alias+"."+name))
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseImport parses the imported file and adds the templates it defines to tpl
+// under their private names. it returns the names of the templates
+func (s *XTemplate) parseImport(st *parseState, tpl *template.Template, file string) (map[string]bool, error) {
+	fle := path.Join(s.rootFolder, file)
+	content, err := st.readFile(s.fs, fle)
+	if err != nil {
+		return nil, err
+	}
+
+	// the macros declared by the file are added under their private names
+	macros := st.macros
+	st.macros = map[string]*macroSig{}
+	content, _, err = preProcess(s, st, fle, content)
+	for name, sig := range st.macros {
+		macros[importedName(file, name)] = sig
+	}
+	st.macros = macros
+	if err != nil {
+		return nil, err
+	}
+
+	lib, err := s.cloneShared()
+	if err != nil {
+		return nil, err
+	}
+	shared := map[string]bool{}
+	for _, t := range lib.Templates() {
+		shared[t.Name()] = true
+	}
+	if _, err = st.parse(lib.New(file), fle, content); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, t := range lib.Templates() {
+		if t.Tree != nil && t.Name() != file && !shared[t.Name()] {
+			names[t.Name()] = true
+		}
+	}
+
+	for name := range names {
+		tree := lib.Lookup(name).Tree.Copy()
+		tree.Name = importedName(file, name)
+		renameTemplates(tree.Root, file, names)
+		if _, err = tpl.AddParseTree(tree.Name, tree); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// renameTemplates replaces the names of the {{ template }} actions within list
+// calling the templates of the imported file with their private names
+func renameTemplates(list *parse.ListNode, file string, names map[string]bool) {
+	for _, n := range templateNodes(list, nil) {
+		if names[n.Name] {
+			n.Name = importedName(file, n.Name)
+		}
+		if cmd := callerCmd(n); cmd != nil {
+			// the body of a {{ call }}
+			if body, ok := cmd.Args[1].(*parse.StringNode); ok && names[body.Text] {
+				body.Text = importedName(file, body.Text)
+				body.Quoted = strconv.Quote(body.Text)
+			}
+		}
+	}
+}
+
+// templateNodes returns the {{ template }} actions within list
+func templateNodes(list *parse.ListNode, found []*parse.TemplateNode) []*parse.TemplateNode {
+	if list == nil {
+		return found
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TemplateNode:
+			found = append(found, n)
+		case *parse.IfNode:
+			found = templateNodes(n.List, templateNodes(n.ElseList, found))
+		case *parse.RangeNode:
+			found = templateNodes(n.List, templateNodes(n.ElseList, found))
+		case *parse.WithNode:
+			found = templateNodes(n.List, templateNodes(n.ElseList, found))
+		case *parse.ListNode:
+			found = templateNodes(n, found)
+		}
+	}
+
+	return found
+}
+
+// macroName returns the name of the template called by {{ macro name(...) }}, the
+// private name of an imported template for namespace.name
+func macroName(imports map[string]string, name string) string {
+	i := strings.Index(name, ".")
+	if i < 0 {
+		return name
+	}
+
+	if file, found := imports[name[:i]]; found {
+		return importedName(file, name[i+1:])
+	}
+
+	return name
+}
+
+// warn reports a warning found while parsing a template
+func (s *XTemplate) warn(err error) {
+	if s.warnFunc != nil {
+		s.warnFunc(err)
+		return
+	}
+
+	log.Printf("xtemplate: warning: %s", err)
+}
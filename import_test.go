@@ -0,0 +1,77 @@
+package xtemplate
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/forms.html": {Data: []byte(`{{ define "label" }}<label>{{ . }}</label>{{ end }}` +
+			`{{ define "input" }}{{ macro label(.) }}<input name="{{ . }}">{{ end }}`)},
+		"views/_partials/buttons.html": {Data: []byte(`{{ define "input" }}<button>{{ . }}</button>{{ end }}`)},
+		"views/page.html": {Data: []byte(`{{ import "forms.html" as f }}
+{{- define "label" }}page label{{ end -}}
+{{ macro f.input("email") }}|{{ macro label("x") }}`)},
+	}
+
+	var warnings []string
+	xt := New(Config{FS: fsys, RootFolder: "views", Warn: func(err error) {
+		warnings = append(warnings, err.Error())
+	}})
+
+	tests := []renderCase{
+		{
+			name:     "namespaced",
+			src:      `{{ import "forms.html" as f }}{{ macro f.input("email") }}`,
+			expected: `<label>email</label><input name="email">`,
+		},
+		{
+			name: "same names",
+			src: `{{ import "forms" as f }}
+{{ import "buttons" as b }}
+{{ macro f.input("a") }}{{ macro b.input("b") }}`,
+			expected: `<label>a</label><input name="a"><button>b</button>`,
+		},
+		{
+			name:     "library calls",
+			src:      `{{ import "forms.html" as f }}{{ define "label" }}page{{ end }}{{ macro f.input("a") }}{{ macro label("a") }}`,
+			expected: `<label>a</label><input name="a">page`,
+		},
+		{
+			name: "shadowed import",
+			src: `{{ import "forms.html" as f }}
+{{ import "buttons.html" as f }}
+{{ macro f.input("a") }}`,
+			expected: `<button>a</button>`,
+		},
+		{
+			name:     "shadowed template",
+			src:      `{{ import "buttons.html" as f }}{{ define "f.input" }}x{{ end }}{{ macro f.input("a") }}`,
+			expected: `<button>a</button>`,
+		},
+		{
+			name:    "missing",
+			src:     `{{ import "nope.html" as f }}`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, nil, tests)
+	// shadowed imports and templates are reported as warnings
+	assert.Equal(t, []string{
+		`template: <string>:2: import "buttons.html" as f shadows the import of "forms.html"`,
+		`template: <string>:1: import "_partials/buttons.html" as f shadows template "f.input"`,
+	}, warnings)
+
+	warnings = nil
+	buf := &bytes.Buffer{}
+	err := xt.Render(buf, "page", nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `<label>email</label><input name="email">|page label`, buf.String())
+	assert.Empty(t, warnings)
+}
@@ -0,0 +1,173 @@
+package xtemplate
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+/*
+	{{ include "name" }} adds the templates defined by a file to the template,
+	an include with a list of names or modifiers renders the file in place
+
+	{{ include "widgets/price.html" with .Product }}         the file's data is the caller's data merged with .Product
+	{{ include "widgets/price.html" with .Product only }}    the file's data is .Product
+	{{ include "widgets/price.html" only }}                  the file has no data
+	{{ include "promo.html" ignore missing }}                nothing is rendered if the file doesn't exist
+	{{ include ["sale.html", "promo.html"] }}                the first file that exists is rendered
+
+	a name is a file relative to the root folder or the partials folder
+*/
+
+// "name" in an include action
+var quotedRe = regexp.MustCompile(`"([^"]*)"`)
+
+// include is an inline include action
+type include struct {
+	names  []string
+	ignore bool
+	with   string
+	only   bool
+}
+
+// parseInclude parses the names and modifiers of an include action
+func parseInclude(names, modifiers string) (*include, error) {
+	inc := &include{}
+	for _, n := range quotedRe.FindAllStringSubmatch(names, -1) {
+		inc.names = append(inc.names, n[1])
+	}
+	if len(inc.names) == 0 {
+		return nil, fmt.Errorf("include: expects a template name")
+	}
+
+	rest := strings.TrimSpace(modifiers)
+	if strings.HasPrefix(rest, "ignore missing") {
+		inc.ignore = true
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "ignore missing"))
+	}
+	if rest == "only" || strings.HasSuffix(rest, " only") {
+		inc.only = true
+		rest = strings.TrimSpace(strings.TrimSuffix(rest, "only"))
+	}
+	if strings.HasPrefix(rest, "with ") {
+		inc.with = strings.TrimSpace(strings.TrimPrefix(rest, "with "))
+		rest = ""
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("include: unexpected %q", rest)
+	}
+
+	return inc, nil
+}
+
+// data returns the pipeline passed to the included template
+func (inc *include) data() string {
+	switch {
+	case inc.only && inc.with == "":
+		return ""
+	case inc.only:
+		return inc.with
+	case inc.with != "":
+		return fmt.Sprintf("includeScope . (%s)", inc.with)
+	}
+
+	return "."
+}
+
+// resolveInclude returns the first name of inc that's a file as a file relative
+// to the root folder and its template name
+func (s *XTemplate) resolveInclude(st *parseState, inc *include) (file, tplName string, found bool) {
+	for _, n := range inc.names {
+		if fle, found := s.findFile(st, n); found {
+			file = s.relName(fle)
+			return file, strings.TrimSuffix(file, "."+s.ext), true
+		}
+	}
+
+	return "", "", false
+}
+
+// findFile returns the path of the file named name in the root or partials folder.
+// the files that don't exist are recorded in st
+func (s *XTemplate) findFile(st *parseState, name string) (string, bool) {
+	for _, folder := range []string{s.rootFolder, s.partialsFolder} {
+		fle, _ := getFilename(folder, name, s.ext)
+		if _, err := fs.Stat(s.fs, fle); err == nil {
+			return fle, true
+		}
+		st.missing(fle)
+	}
+
+	return "", false
+}
+
+// includeScope returns data merged with with if both are maps, otherwise with
+func includeScope(data, with interface{}) interface{} {
+	d, ok := data.(map[string]interface{})
+	w, ok2 := with.(map[string]interface{})
+	if !ok || !ok2 {
+		return with
+	}
+
+	retv := make(map[string]interface{}, len(d)+len(w))
+	for k, v := range d {
+		retv[k] = v
+	}
+	for k, v := range w {
+		retv[k] = v
+	}
+
+	return retv
+}
+
+// translateIncludes converts the inline include actions of src into template actions
+// and adds the files they include to fm
+func translateIncludes(xt *XTemplate, st *parseState, fm *frontMatter, src []byte, m srcMap) (*frontMatter, []byte, srcMap, error) {
+	sx := xt.syntax()
+	locs := sx.includeRe.FindAllSubmatchIndex(src, -1)
+	if locs == nil {
+		return fm, src, m, nil
+	}
+
+	m = m.ensure(src)
+	b := docBuilder{}
+	pos := 0
+	for _, loc := range locs {
+		names, modifiers := string(src[loc[4]:loc[5]]), string(src[loc[6]:loc[7]])
+		if strings.TrimSpace(modifiers) == "" && strings.Count(names, `"`) == 2 && !strings.HasPrefix(names, "[") {
+			// {{ include "name" }}
+			continue
+		}
+
+		inc, err := parseInclude(names, modifiers)
+		if err != nil {
+			return nil, nil, nil, newTemplateError(m.at(src, loc[0]), "%s", err)
+		}
+
+		var repl []byte
+		file, tplName, found := xt.resolveInclude(st, inc)
+		switch {
+		case found:
+			trimL, trimR := string(src[loc[2]:loc[3]]), string(src[loc[8]:loc[9]])
+			repl = []byte(sx.action("%s template %q %s %s", trimL, tplName, inc.data(), trimR))
+			if fm == nil {
+				fm = &frontMatter{}
+			}
+			fm.Include = append(fm.Include, IncludeFile(file))
+		case !inc.ignore:
+			return nil, nil, nil, newTemplateError(m.at(src, loc[0]), "include: no file or partial named %q", strings.Join(inc.names, `", "`))
+		}
+
+		b.copy(src, m, pos, loc[0])
+		b.replace(src, m, loc[0], loc[1], repl, nil)
+		pos = loc[1]
+	}
+	if pos == 0 {
+		return fm, src, m, nil
+	}
+	b.copy(src, m, pos, len(src))
+
+	src, m = b.result()
+	return fm, src, m, nil
+}
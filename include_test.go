@@ -0,0 +1,83 @@
+package xtemplate
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInclude(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/widgets/price.html":    {Data: []byte(`{{ .name }}: {{ .price }}`)},
+		"views/promo.html":            {Data: []byte(`promo {{ .name }}`)},
+		"views/_partials/badge.html":  {Data: []byte(`<b>{{ . }}</b>`)},
+		"views/widgets/defines.html":  {Data: []byte(`{{ define "note" }}note{{ end }}`)},
+		"views/page.html":             {Data: []byte(`{{ include "widgets/price.html" with .product }}|{{ include "widgets/price" with .product only }}`)},
+		"views/nested/widgets/x.html": {Data: []byte(`x`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{
+		"name":    "page",
+		"price":   1,
+		"product": map[string]interface{}{"name": "pen"},
+	}
+
+	tests := []renderCase{
+		{
+			name:     "with",
+			src:      `{{ include "widgets/price.html" with .product }}`,
+			expected: `pen: 1`,
+		},
+		{
+			name:     "with only",
+			src:      `{{ include "widgets/price.html" with .product only }}`,
+			expected: `pen: `,
+		},
+		{
+			name:     "only",
+			src:      `{{- include "promo.html" only -}}`,
+			expected: `promo `,
+		},
+		{
+			name:     "partial",
+			src:      `{{ include "badge" with "new" }}`,
+			expected: `<b>new</b>`,
+		},
+		{
+			name:     "fallbacks",
+			src:      `{{ include ["sale.html", "promo.html"] }}`,
+			expected: `promo page`,
+		},
+		{
+			name:     "ignore missing",
+			src:      `a{{ include "sale.html" ignore missing with .product }}b`,
+			expected: `ab`,
+		},
+		{
+			name:     "defines",
+			src:      `{{ include "widgets/defines.html" }}{{ template "note" }}`,
+			expected: `note`,
+		},
+		{
+			name:    "missing",
+			src:     `{{ include "sale.html" with .product }}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			src:     `{{ include "promo.html" without .product }}`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+
+	buf := &bytes.Buffer{}
+	err := xt.Render(buf, "page", data, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "pen: 1|pen: ", buf.String())
+}
@@ -0,0 +1,279 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+/*
+	{{ defmacro name(params) }} defines a template whose parameters are declared,
+	a parameter without a default is required
+
+	{{ defmacro button(label, kind="primary", disabled=false) }}
+		<button class="btn-{{ .kind }}" {{ if .disabled }}disabled{{ end }}>{{ .label }}</button>
+	{{ end }}
+
+	{{ macro button("Save") }}                        --> {{ template "button" kwargs "label" "Save" "kind" "primary" "disabled" false }}
+	{{ macro button("Delete", "danger") }}            --> {{ template "button" kwargs "label" "Delete" "kind" "danger" "disabled" false }}
+	{{ macro button("label"::"Go", "disabled"::true) }}
+
+	the calls are bound to the parameters once the template is parsed, a call missing
+	a required parameter, passing too many arguments or an unknown parameter fails to parse.
+	a call with a single argument, such as {{ template "button" . }}, binds it to the
+	first parameter. the defaults are literals: strings, numbers, booleans or nil
+*/
+
+// param, param="default"...
+var macroParamRe = regexp.MustCompile(`^([a-zA-Z_]\w*)\s*(?:=\s*(.+))?$`)
+
+// macroSig is the signature of a macro declared with defmacro
+type macroSig struct {
+	name   string
+	params []macroParam
+}
+
+// macroParam is a parameter of a macro, def is nil for required parameters
+type macroParam struct {
+	name string
+	def  parse.Node
+}
+
+// parseMacroSig parses the parameters of macro name: label, kind="primary"...
+func parseMacroSig(name, params string) (*macroSig, error) {
+	sig := &macroSig{name: name}
+	for _, p := range splitParams(params) {
+		parts := macroParamRe.FindStringSubmatch(p)
+		if parts == nil {
+			return nil, fmt.Errorf("defmacro %s: invalid parameter %q", name, p)
+		}
+
+		param := macroParam{name: parts[1]}
+		if parts[2] != "" {
+			def, err := literalNode(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("defmacro %s: default of %s: %s", name, param.name, err)
+			}
+			param.def = def
+		}
+		if sig.param(param.name) >= 0 {
+			return nil, fmt.Errorf("defmacro %s: duplicate parameter %s", name, param.name)
+		}
+		sig.params = append(sig.params, param)
+	}
+
+	return sig, nil
+}
+
+// param returns the index of parameter name or -1
+func (sig *macroSig) param(name string) int {
+	for i, p := range sig.params {
+		if p.name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// splitParams splits the comma separated parameters of a macro, commas within
+// quoted defaults don't separate parameters
+func splitParams(params string) []string {
+	var (
+		retv  []string
+		quote rune
+		start int
+	)
+
+	for i, c := range params {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`' || c == '\'':
+			quote = c
+		case c == ',':
+			retv = append(retv, strings.TrimSpace(params[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(params[start:]); last != "" || len(retv) > 0 {
+		retv = append(retv, last)
+	}
+
+	return retv
+}
+
+// literalNode returns the node of a literal: "text", 12, true, nil...
+func literalNode(s string) (parse.Node, error) {
+	trees, err := parse.Parse("default", "{{"+s+"}}", "{{", "}}")
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal %s", s)
+	}
+
+	root := trees["default"].Root
+	if len(root.Nodes) == 1 {
+		if action, ok := root.Nodes[0].(*parse.ActionNode); ok && len(action.Pipe.Cmds) == 1 && len(action.Pipe.Cmds[0].Args) == 1 {
+			switch n := action.Pipe.Cmds[0].Args[0].(type) {
+			case *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+				return n, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%s isn't a literal", s)
+}
+
+// translateDefMacros converts {{ defmacro name(params) }} into {{ define "name" }}
+// and records the signature of the macros in st
+func translateDefMacros(xt *XTemplate, st *parseState, src []byte, m srcMap) ([]byte, srcMap, error) {
+	sx := xt.syntax()
+	locs := sx.defmacroRe.FindAllSubmatchIndex(src, -1)
+	if locs == nil {
+		return src, m, nil
+	}
+
+	m = m.ensure(src)
+	b := docBuilder{}
+	pos := 0
+	for _, loc := range locs {
+		name := string(src[loc[4]:loc[5]])
+		sig, err := parseMacroSig(name, string(src[loc[6]:loc[7]]))
+		if err != nil {
+			return nil, nil, newTemplateError(m.at(src, loc[0]), "%s", err)
+		}
+		st.macros[name] = sig
+
+		trimL, trimR := string(src[loc[2]:loc[3]]), string(src[loc[8]:loc[9]])
+		b.copy(src, m, pos, loc[0])
+		b.replace(src, m, loc[0], loc[1], []byte(sx.action("%s define %q %s", trimL, name, trimR)), nil)
+		pos = loc[1]
+	}
+	b.copy(src, m, pos, len(src))
+
+	src, m = b.result()
+	return src, m, nil
+}
+
+// bindMacros binds the arguments of the calls of the macros declared with defmacro
+// to their parameters: {{ template "name" args }} --> {{ template "name" kwargs "param" arg... }}
+// and checks the arguments of the {{ call }} actions of the other macros are a map
+func (s *XTemplate) bindMacros(st *parseState, tpl *template.Template) error {
+	called := map[string]bool{}
+	for _, t := range tpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+
+		for _, n := range templateNodes(t.Tree.Root, nil) {
+			// the arguments of a {{ call }} are within withCaller
+			pipe, caller := n.Pipe, callerCmd(n)
+			if caller != nil {
+				pipe, _ = caller.Args[4].(*parse.PipeNode)
+				called[n.Name] = true
+			}
+
+			var err error
+			sig, found := st.macros[n.Name]
+			switch {
+			case found:
+				if pipe, err = sig.bind(t.Tree, pipe, n.Pos, n.Line); err != nil {
+					break
+				}
+				if caller != nil {
+					caller.Args[4] = pipe
+				} else {
+					n.Pipe = pipe
+				}
+			case caller != nil && !isKwargs(pipe):
+				err = fmt.Errorf("call %s: the macro must be declared with defmacro or called with keyword arguments", n.Name)
+			}
+			if err != nil {
+				err = fmt.Errorf("template: %s:%d: %s", t.Tree.ParseName, n.Line, err)
+				return st.src.wrap(err)
+			}
+		}
+	}
+
+	s.passCaller(tpl, called)
+	return nil
+}
+
+// isKwargs reports whether pipe is kwargs ...
+func isKwargs(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 {
+		return false
+	}
+
+	ident, ok := pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "kwargs"
+}
+
+// bind returns the pipeline passing the arguments of a call, pipe, to the macro as a map
+func (sig *macroSig) bind(tree *parse.Tree, pipe *parse.PipeNode, pos parse.Pos, line int) (*parse.PipeNode, error) {
+	values := make([]parse.Node, len(sig.params))
+
+	var (
+		cmd   *parse.CommandNode
+		ident *parse.IdentifierNode
+	)
+	if pipe != nil && len(pipe.Decl) == 0 && len(pipe.Cmds) == 1 {
+		cmd = pipe.Cmds[0]
+		ident, _ = cmd.Args[0].(*parse.IdentifierNode)
+	}
+
+	switch {
+	case pipe == nil:
+		// no arguments
+	case ident != nil && ident.Ident == "kwargs":
+		if len(cmd.Args)%2 == 0 {
+			return nil, fmt.Errorf("macro %s: expects name value pairs", sig.name)
+		}
+		for i := 1; i < len(cmd.Args); i += 2 {
+			key, ok := cmd.Args[i].(*parse.StringNode)
+			if !ok {
+				return nil, fmt.Errorf("macro %s: parameter names must be strings", sig.name)
+			}
+			p := sig.param(key.Text)
+			if p < 0 {
+				return nil, fmt.Errorf("macro %s: unknown parameter %q", sig.name, key.Text)
+			}
+			values[p] = cmd.Args[i+1]
+		}
+	case ident != nil && ident.Ident == "args":
+		if len(cmd.Args)-1 > len(sig.params) {
+			return nil, fmt.Errorf("macro %s: expects at most %d arguments, got %d", sig.name, len(sig.params), len(cmd.Args)-1)
+		}
+		copy(values, cmd.Args[1:])
+	default:
+		if len(sig.params) == 0 {
+			return nil, fmt.Errorf("macro %s: expects no arguments", sig.name)
+		}
+		if cmd != nil && len(cmd.Args) == 1 {
+			values[0] = cmd.Args[0]
+		} else {
+			values[0] = pipe
+		}
+	}
+
+	kwargs := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pos}
+	kwargs.Args = append(kwargs.Args, parse.NewIdentifier("kwargs").SetTree(tree).SetPos(pos))
+	for i, p := range sig.params {
+		value := values[i]
+		if value == nil {
+			if p.def == nil {
+				return nil, fmt.Errorf("macro %s: missing required parameter %s", sig.name, p.name)
+			}
+			value = p.def.Copy()
+		}
+
+		key := &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(p.name), Text: p.name}
+		kwargs.Args = append(kwargs.Args, key, value)
+	}
+
+	return &parse.PipeNode{NodeType: parse.NodePipe, Pos: pos, Line: line, Cmds: []*parse.CommandNode{kwargs}}, nil
+}
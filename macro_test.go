@@ -0,0 +1,94 @@
+package xtemplate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefMacro(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/buttons.html": {Data: []byte(`{{ defmacro button(label, kind="primary", disabled=false) -}}
+<button class="btn-{{ .kind }}"{{ if .disabled }} disabled{{ end }}>{{ .label }}</button>
+{{- end }}`)},
+		"views/forms.html": {Data: []byte(`{{ defmacro input(name, type="text") }}<input type="{{ .type }}" name="{{ .name }}">{{ end }}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{"name": "email"}
+
+	tests := []renderCase{
+		{
+			name:     "defaults",
+			src:      `{{ include "buttons.html" }}{{ macro button("Save") }}`,
+			expected: `<button class="btn-primary">Save</button>`,
+		},
+		{
+			name:     "positional",
+			src:      `{{ include "buttons.html" }}{{ macro button("Delete", "danger", true) }}`,
+			expected: `<button class="btn-danger" disabled>Delete</button>`,
+		},
+		{
+			name:     "commas in strings",
+			src:      `{{ include "buttons.html" }}{{ macro button("Hello, world") }}{{ macro button("a, b", "c::d") }}`,
+			expected: `<button class="btn-primary">Hello, world</button><button class="btn-c::d">a, b</button>`,
+		},
+		{
+			name:     "pipelines",
+			src:      `{{ include "buttons.html" }}{{ macro button("label"::(printf "%s, %s" .name "x"), "kind"::"a,b") }}`,
+			expected: `<button class="btn-a,b">email, x</button>`,
+		},
+		{
+			name:     "keywords",
+			src:      `{{ include "buttons.html" }}{{ macro button("disabled"::true, "label"::"Go") }}`,
+			expected: `<button class="btn-primary" disabled>Go</button>`,
+		},
+		{
+			name:     "single argument",
+			src:      `{{ include "buttons.html" }}{{ template "button" .name }}`,
+			expected: `<button class="btn-primary">email</button>`,
+		},
+		{
+			name:     "same file",
+			src:      `{{ defmacro greet(who, greeting="hello, ") }}{{ .greeting }}{{ .who }}{{ end }}{{ macro greet(.name) }}`,
+			expected: `hello, email`,
+		},
+		{
+			name:     "imported",
+			src:      `{{ import "forms.html" as f }}{{ macro f.input("name"::.name, "type"::"email") }}`,
+			expected: `<input type="email" name="email">`,
+		},
+		{
+			name:    "missing required",
+			src:     `{{ include "buttons.html" }}{{ macro button("kind"::"danger") }}`,
+			wantErr: true,
+		},
+		{
+			name:    "too many",
+			src:     `{{ include "buttons.html" }}{{ macro button("a", "b", true, 1) }}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown parameter",
+			src:     `{{ include "buttons.html" }}{{ macro button("label"::"a", "size"::"lg") }}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid default",
+			src:     `{{ defmacro a(b=.c) }}{{ end }}`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+
+	_, err := xt.RenderString("{{ include \"buttons.html\" }}\n{{ macro button() }}", data)
+	assert.EqualError(t, err, "template: <string>:2: macro button: missing required parameter label")
+}
+
+func Test_splitParams(t *testing.T) {
+	assert.Equal(t, []string(nil), splitParams(" "))
+	assert.Equal(t, []string{"a", `b="x, y"`, "c=1"}, splitParams(`a, b="x, y", c=1`))
+}
@@ -0,0 +1,187 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+/*
+	a template can start with a YAML front matter, it can set the master template,
+	the included templates and any metadata
+
+	---
+	master: layout.html
+	include: [nav.html]
+	title: Products
+	cache: 5m
+	---
+	{{define "body"}}...{{end}}
+
+	the metadata of a template and its masters (the template's values win) is returned
+	by the meta function, {{ meta "title" }} or {{ (meta).og.image }}, and by XTemplate.Meta.
+	it's also added to map[string]interface{} data as .meta.
+	a meta function registered by Config.Funcs, Funcs or AddFunc wins over the builtin one.
+	the front matter of a component is removed but its metadata isn't used
+*/
+
+// ---\n(yaml)\n---
+var yamlFrontMatterRe = regexp.MustCompile(`(?s)^---[ \t]*\r?\n(.*?\r?\n)?---[ \t]*(?:\r?\n|$)`)
+
+// yaml: line 2: description
+var yamlErrLineRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// extractYAMLFrontMatter removes the YAML front matter from the start of src
+func extractYAMLFrontMatter(src []byte, m srcMap) (*frontMatter, []byte, srcMap, error) {
+	loc := yamlFrontMatterRe.FindSubmatchIndex(src)
+	if loc == nil {
+		return nil, src, m, nil
+	}
+
+	m = m.ensure(src)
+	fm := &frontMatter{}
+	if loc[2] < 0 {
+		// empty front matter
+		loc[2], loc[3] = loc[1], loc[1]
+	}
+	if err := yaml.Unmarshal(src[loc[2]:loc[3]], fm); err != nil {
+		// the yaml starts on the second line
+		line, desc := 1, err.Error()
+		if parts := yamlErrLineRe.FindStringSubmatch(desc); parts != nil {
+			line, _ = strconv.Atoi(parts[1])
+			desc = parts[2]
+		}
+		if line >= len(m) {
+			line = len(m) - 1
+		}
+		return nil, nil, nil, newTemplateError(m[line], "invalid front matter: %s", desc)
+	}
+	fm.Meta = normalizeYAML(fm.Meta).(map[string]interface{})
+
+	src, m = splice(src, m, loc[0], loc[1], nil, nil)
+	return fm, src, m, nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} maps within v to map[string]interface{}
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		retv := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			retv[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return retv
+	case map[string]interface{}:
+		retv := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			retv[k] = normalizeYAML(val)
+		}
+		return retv
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeYAML(v[i])
+		}
+	}
+
+	return v
+}
+
+// merge adds the master and includes set by the actions of a template, in actions, to fm
+func (fm *frontMatter) merge(actions *frontMatter) *frontMatter {
+	if fm == nil || actions == nil {
+		if fm == nil {
+			return actions
+		}
+		return fm
+	}
+
+	if actions.Master != "" {
+		fm.Master = actions.Master
+	}
+	fm.Include = append(fm.Include, actions.Include...)
+	return fm
+}
+
+// addMeta adds the metadata of fm, which isn't set already, to the template's metadata.
+// a template is read before its master so its values win
+func (st *parseState) addMeta(fm *frontMatter) {
+	if st == nil || fm == nil {
+		return
+	}
+
+	for k, v := range fm.Meta {
+		if _, found := st.meta[k]; !found {
+			st.meta[k] = v
+		}
+	}
+}
+
+// withMeta adds meta to data as "meta" if data is a map (or nil) without a meta key
+func withMeta(meta map[string]interface{}, data interface{}) interface{} {
+	if len(meta) == 0 {
+		return data
+	}
+
+	switch d := data.(type) {
+	case nil:
+		return map[string]interface{}{"meta": meta}
+	case map[string]interface{}:
+		if _, found := d["meta"]; found {
+			return data
+		}
+
+		retv := make(map[string]interface{}, len(d)+1)
+		for k, v := range d {
+			retv[k] = v
+		}
+		retv["meta"] = meta
+		return retv
+	}
+
+	return data
+}
+
+// bindMeta binds the meta function of tpl to meta, the metadata of the template.
+// a meta function registered by the user isn't replaced
+func (s *XTemplate) bindMeta(tpl *template.Template, meta map[string]interface{}) *template.Template {
+	if s.userFunc("meta") {
+		return tpl
+	}
+	return tpl.Funcs(template.FuncMap{"meta": metaFunc(meta)})
+}
+
+// metaFunc returns the meta function: it returns the value of key or, without a key, all the metadata
+func metaFunc(meta map[string]interface{}) interface{} {
+	return func(key ...string) (interface{}, error) {
+		switch len(key) {
+		case 0:
+			if meta == nil {
+				return map[string]interface{}{}, nil
+			}
+			return meta, nil
+		case 1:
+			return meta[key[0]], nil
+		}
+
+		return nil, fmt.Errorf("meta: expects at most one key")
+	}
+}
+
+// Meta returns the metadata of template name (and its masters) set by their
+// front matter. the template is parsed and cached if it isn't cached
+func (s *XTemplate) Meta(name string) (map[string]interface{}, error) {
+	entry, err := s.cachedTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	retv := make(map[string]interface{}, len(entry.meta))
+	for k, v := range entry.meta {
+		retv[k] = v
+	}
+
+	return retv, nil
+}
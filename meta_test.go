@@ -0,0 +1,93 @@
+package xtemplate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrontMatter(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/layout.html": {Data: []byte(`---
+title: Site
+lang: en
+---
+<title>{{ .meta.title }} ({{ .meta.lang }})</title>{{block "body" .}}{{end}}`)},
+		"views/nav.html": {Data: []byte(`<nav>{{ .name }}</nav>`)},
+		"views/page.html": {Data: []byte(`---
+master: layout.html
+include: [nav.html]
+title: Products
+cache: 300
+og:
+  image: /p.png
+---
+{{define "body"}}{{ template "nav" . }}{{ .meta.og.image }} {{ .meta.cache }}{{end}}`)},
+		"views/invalid.html": {Data: []byte("---\ntitle: a\n  b: c\n---\n")},
+		"views/empty.html":   {Data: []byte("---\n---\n<p>{{ .name }}</p>")},
+		"views/struct.html": {Data: []byte(`---
+title: Struct
+og:
+  image: /s.png
+---
+{{ .Name }} {{ meta "title" }} {{ (meta).og.image }}{{ meta "none" }} <x-badge />`)},
+		"views/home.html":              {Data: []byte("---\ntitle: Home\n---\n{{ meta \"title\" }} {{ .meta.title }}")},
+		"views/_components/badge.html": {Data: []byte("---\ntitle: Badge\n---\n<b>{{ meta \"title\" }}</b>")},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+
+	buff := bytes.NewBufferString("")
+	assert.NoError(t, xt.Render(buff, "page", map[string]interface{}{"name": "dinma"}, false))
+	assert.Equal(t, "<title>Products (en)</title><nav>dinma</nav>/p.png 300", buff.String())
+
+	meta, err := xt.Meta("page")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"title": "Products", "lang": "en", "cache": 300,
+		"og": map[string]interface{}{"image": "/p.png"},
+	}, meta)
+
+	// data with a meta key or that isn't a map is unchanged
+	buff.Reset()
+	assert.NoError(t, xt.Render(buff, "layout", map[string]interface{}{"meta": map[string]string{"title": "mine"}}, false))
+	assert.Equal(t, "<title>mine ()</title>", buff.String())
+
+	buff.Reset()
+	assert.NoError(t, xt.Render(buff, "empty", map[string]interface{}{"name": "dinma"}, false))
+	assert.Equal(t, "<p>dinma</p>", buff.String())
+
+	_, err = xt.Meta("invalid")
+	var tErr *TemplateError
+	if assert.True(t, errors.As(err, &tErr), "%v", err) {
+		assert.Equal(t, Position{File: "views/invalid.html", Line: 3}, tErr.Position)
+	}
+
+	// the meta function works with any data, a component's front matter is removed
+	buff.Reset()
+	assert.NoError(t, xt.Render(buff, "struct", struct{ Name string }{"dinma"}, false))
+	assert.Equal(t, "dinma Struct /s.png<b>Struct</b>\n", buff.String())
+
+	retv, err := xt.RenderString("---\nmaster: layout.html\ntitle: Home\n---\n{{define \"body\"}}!{{end}}", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<title>Home (en)</title>!", retv)
+
+	// a meta function registered by the user wins
+	mine := func(key string) string { return "mine:" + key }
+	for _, xt := range []*XTemplate{
+		New(Config{FS: fsys, RootFolder: "views", Funcs: map[string]interface{}{"meta": mine}}),
+		New(Config{FS: fsys, RootFolder: "views"}).AddFunc("meta", mine),
+	} {
+		buff.Reset()
+		assert.NoError(t, xt.Render(buff, "home", nil, false))
+		assert.Equal(t, "mine:title Home", buff.String())
+
+		retv, err = xt.RenderString("---\ntitle: Home\n---\n{{ meta \"title\" }}", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "mine:title", retv)
+	}
+}
@@ -0,0 +1,340 @@
+package xtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	component templates can declare their props in a header
+
+	{{ props }}
+	title  string required
+	size   string = "md"
+	count  int    = 3
+	active bool
+	tags   list   = "a, b"
+	{{ end }}
+
+	the attributes of the component tag are converted to the declared types
+	(list attributes are comma separated) and props that aren't used are set
+	to their default or zero value. a missing required prop or an attribute
+	that isn't declared is reported when the page using the component is parsed.
+	components without a header receive their attributes as strings and an attribute
+	without a value, <x-button disabled>, as true
+
+	a prop can also be bound to a template expression, evaluated where the tag is used,
+	to pass any value to the component:
+	<component type="list" :items=".Products" props-title="{{ .Title }}"></component>
+
+	the actions within the other attributes are evaluated the same way, title="Hello {{ .Name }}"
+	is bound to printf "Hello %v" (.Name)
+*/
+
+type propType string
+
+const (
+	propString propType = "string"
+	propInt    propType = "int"
+	propBool   propType = "bool"
+	propList   propType = "list"
+)
+
+// propDef is a prop declared in the header of a component template
+type propDef struct {
+	name     string
+	typ      propType
+	def      string
+	hasDef   bool
+	required bool
+}
+
+// propSchema lists the props of a component in the order they were declared
+type propSchema []*propDef
+
+// name type [= default] [required]
+var propLineRe = regexp.MustCompile(`^([a-zA-Z_][\w-]*)\s+(string|int|bool|list)(?:\s*=\s*("(?:[^"\\]|\\.)*"|[^\s"]+))?(\s+required)?$`)
+
+// extractProps removes the props header from cTpl, the template of a component whose
+// lines originate from m. nil is returned as the schema if cTpl doesn't have a header
+func extractProps(sx *syntax, cTpl []byte, m srcMap) (propSchema, []byte, srcMap, error) {
+	loc := sx.propsRe.FindSubmatchIndex(cTpl)
+	if loc == nil {
+		return nil, cTpl, m, nil
+	}
+
+	schema := propSchema{}
+	pos := loc[2]
+	for _, line := range strings.SplitAfter(string(cTpl[loc[2]:loc[3]]), "\n") {
+		linePos := pos
+		pos += len(line)
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := propLineRe.FindStringSubmatch(line)
+		if parts == nil {
+			return nil, nil, nil, newTemplateError(m.at(cTpl, linePos), "invalid prop declaration %q", line)
+		}
+
+		prop := &propDef{name: parts[1], typ: propType(parts[2]), required: parts[4] != ""}
+		if parts[3] != "" {
+			prop.def, prop.hasDef = parts[3], true
+			if def, err := strconv.Unquote(parts[3]); err == nil {
+				prop.def = def
+			}
+			if _, err := prop.literal(prop.def); err != nil {
+				return nil, nil, nil, newTemplateError(m.at(cTpl, linePos), "invalid default: %s", err)
+			}
+		}
+
+		if schema.lookup(prop.name) != nil {
+			return nil, nil, nil, newTemplateError(m.at(cTpl, linePos), "prop %s is declared twice", prop.name)
+		}
+		schema = append(schema, prop)
+	}
+
+	cTpl, m = splice(cTpl, m, loc[0], loc[1], nil, nil)
+	return schema, cTpl, m, nil
+}
+
+func (ps propSchema) lookup(name string) *propDef {
+	for _, p := range ps {
+		if strings.EqualFold(p.name, name) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// propValue is the value given to a prop by a component tag
+type propValue struct {
+	value string
+	// value is a template expression evaluated in the scope of the tag
+	bound bool
+	// the attribute doesn't have a value
+	bare bool
+}
+
+// tagProps returns the props set by the attributes of a component tag.
+// the value of a bound attribute, :items=".Products" or props-items="{{ .Products }}",
+// is a template expression
+func tagProps(d delims, tag *Tag) (map[string]propValue, error) {
+	props := map[string]propValue{}
+	for k, v := range tag.Attr {
+		if k == "type" && !tag.shorthand {
+			continue
+		}
+
+		name, prop := k, propValue{value: v.Value, bare: v.Bare}
+		switch {
+		case strings.HasPrefix(k, ":"):
+			name, prop.bound = k[1:], true
+		case strings.HasPrefix(strings.ToLower(k), "props-"):
+			name, prop.bound = k[len("props-"):], true
+			prop.value = d.unwrap(prop.value)
+		}
+
+		if !prop.bound && strings.Contains(prop.value, d.left) {
+			// title="Hello {{ .Name }}"
+			expr, err := interpolate(d, prop.value)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s: %s", k, err)
+			}
+			prop.value, prop.bound = expr, true
+		}
+		if prop.bound {
+			if prop.value = strings.TrimSpace(prop.value); prop.value == "" {
+				return nil, fmt.Errorf("prop %s is bound to an empty expression", name)
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid attribute %q", k)
+		}
+		for n := range props {
+			if strings.EqualFold(n, name) {
+				return nil, fmt.Errorf("prop %s is set twice", name)
+			}
+		}
+		props[name] = prop
+	}
+
+	return props, nil
+}
+
+// {{ if, {{ else... in an attribute value
+var statementRe = regexp.MustCompile(`^(if|else|range|with|block|define|template|end|break|continue)\b`)
+
+// interpolate returns the expression printing s, an attribute value containing actions:
+// a {{ .B }} c --> printf "a %v c" (.B). a value that's a single action is the action's pipeline
+func interpolate(d delims, s string) (string, error) {
+	if t := d.unwrap(s); t != s && !strings.Contains(t, d.left) {
+		return t, nil
+	}
+
+	var (
+		format string
+		args   []string
+	)
+	for s != "" {
+		start := strings.Index(s, d.left)
+		if start < 0 {
+			format += strings.ReplaceAll(s, "%", "%%")
+			break
+		}
+		end := strings.Index(s[start:], d.right)
+		if end < 0 {
+			return "", fmt.Errorf("unclosed action")
+		}
+
+		expr := d.unwrap(s[start : start+end+len(d.right)])
+		if expr == "" || statementRe.MatchString(expr) {
+			return "", fmt.Errorf("%q isn't an expression", s[start:start+end+len(d.right)])
+		}
+		format += strings.ReplaceAll(s[:start], "%", "%%") + "%v"
+		args = append(args, "("+expr+")")
+		s = s[start+end+len(d.right):]
+	}
+
+	return fmt.Sprintf("printf %q %s", format, strings.Join(args, " ")), nil
+}
+
+// propArgs returns props, sorted by name, as kwargs arguments: "name1" value1 "name2" value2...
+// each argument is preceded by a space and attributes without a value are true
+func propArgs(props map[string]propValue) string {
+	names := make([]string, 0, len(props))
+	for k := range props {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	retv := ""
+	for _, k := range names {
+		if props[k].bound {
+			retv += fmt.Sprintf(" %q (%s)", k, props[k].value)
+			continue
+		}
+		if props[k].bare {
+			retv += fmt.Sprintf(" %q true", k)
+			continue
+		}
+		retv += fmt.Sprintf(" %q %q", k, props[k].value)
+	}
+
+	return retv
+}
+
+// undeclared returns the props that aren't declared in ps
+func (ps propSchema) undeclared(props map[string]propValue) map[string]propValue {
+	retv := map[string]propValue{}
+	for k, v := range props {
+		if ps.lookup(k) == nil {
+			retv[k] = v
+		}
+	}
+
+	return retv
+}
+
+// args returns the declared props set by a component tag as kwargs arguments:
+// "name1" value1 "name2" value2... props that aren't declared are
+// reported unless they're used as attributes
+func (ps propSchema) args(props map[string]propValue, attrs bool) (string, error) {
+	for k := range props {
+		if ps.lookup(k) == nil && !attrs {
+			return "", fmt.Errorf("unknown prop %q", k)
+		}
+	}
+
+	var retv []string
+	for _, p := range ps {
+		var (
+			value string
+			err   error
+		)
+
+		a, found := props[p.name]
+		if !found {
+			// attribute names aren't case sensitive
+			for k, v := range props {
+				if strings.EqualFold(k, p.name) {
+					a, found = v, true
+				}
+			}
+		}
+
+		switch {
+		case found && a.bound:
+			value = "(" + a.value + ")"
+		case found:
+			value, err = p.literal(a.value)
+		case p.required:
+			err = fmt.Errorf("missing required prop %q", p.name)
+		case p.hasDef:
+			value, err = p.literal(p.def)
+		default:
+			value = p.zero()
+		}
+		if err != nil {
+			return "", err
+		}
+
+		retv = append(retv, strconv.Quote(p.name), value)
+	}
+
+	return strings.Join(retv, " "), nil
+}
+
+// literal returns value, converted to the type of the prop, as a template literal
+func (p *propDef) literal(value string) (string, error) {
+	switch p.typ {
+	case propInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("prop %s: %q isn't an int", p.name, value)
+		}
+		return strconv.Itoa(n), nil
+
+	case propBool:
+		// a boolean attribute without a value is true
+		if strings.TrimSpace(value) == "" {
+			return "true", nil
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("prop %s: %q isn't a bool", p.name, value)
+		}
+		return strconv.FormatBool(b), nil
+
+	case propList:
+		items := []string{"args"}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, strconv.Quote(item))
+			}
+		}
+		return "(" + strings.Join(items, " ") + ")", nil
+	}
+
+	return strconv.Quote(value), nil
+}
+
+// zero returns the zero value of the prop's type as a template literal
+func (p *propDef) zero() string {
+	switch p.typ {
+	case propInt:
+		return "0"
+	case propBool:
+		return "false"
+	case propList:
+		return "(args)"
+	}
+
+	return `""`
+}
@@ -0,0 +1,135 @@
+package xtemplate
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponentProps(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/badge.html": {Data: []byte(`{{ props }}
+	# badge props
+	label  string required
+	size   string = "md"
+	count  int    = 3
+	active bool
+	tags   list   = "a, b"
+{{ end }}
+<span class="{{.props.size}}">{{.props.label}} {{ add .props.count 1 }} {{ if .props.active }}on{{ else }}off{{ end }}{{ range .props.tags }} #{{.}}{{ end }}</span>`)},
+		"views/_components/plain.html": {Data: []byte(`<b>{{.props.count}}</b>`)},
+		"views/_components/flag.html":  {Data: []byte(`<i>{{ printf "%T %v" .props.active .props.active }}</i>`)},
+		"views/_components/broken.html": {Data: []byte(`{{ props }}
+	label string
+	count number
+{{ end }}`)},
+		"views/page.html": {Data: []byte(`<p>
+	<component type="badge" label="a" count="x"></component>
+</p>`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	xt.AddFunc("add", func(a, b int) int { return a + b })
+
+	tests := []renderCase{
+		{
+			name:     "defaults",
+			src:      `<component type="badge" label="new"></component>`,
+			expected: `<span class="md">new 4 off #a #b</span>` + "\n",
+		},
+		{
+			name:     "converted",
+			src:      `<component type="badge" label="new" size="lg" count="10" active="" tags="x,y , z"></component>`,
+			expected: `<span class="lg">new 11 on #x #y #z</span>` + "\n",
+		},
+		{
+			name:     "false",
+			src:      `<component type="badge" label="new" active="false" tags=""></component>`,
+			expected: `<span class="md">new 4 off</span>` + "\n",
+		},
+		{
+			name:     "without value",
+			src:      `<x-badge label="new" active></x-badge>`,
+			expected: `<span class="md">new 4 on #a #b</span>` + "\n",
+		},
+		{
+			name:     "untyped without value",
+			src:      `<component type="flag" active></component>`,
+			expected: `<i>bool true</i>` + "\n",
+		},
+		{
+			name:     "untyped",
+			src:      `<component type="plain" count="10"></component>`,
+			expected: `<b>10</b>` + "\n",
+		},
+		{name: "missing", src: `<component type="badge"></component>`, err: `component badge: missing required prop "label"`},
+		{name: "unknown", src: `<component type="badge" label="a" color="red"></component>`, err: `component badge: unknown prop "color"`},
+		{name: "invalid", src: `<component type="badge" label="a" count="many"></component>`, err: `component badge: prop count: "many" isn't an int`},
+		{name: "declaration", src: `<component type="broken"></component>`, err: `invalid prop declaration "count number"`},
+	}
+
+	renderCases(t, xt, nil, tests)
+
+	// errors name the page and the component
+	err := xt.ParseFile("page")
+	assert.EqualError(t, err, `template: views/page.html:2: component badge: prop count: "x" isn't an int`)
+
+	_, err = xt.RenderString("\n<component type=\"broken\"></component>", nil)
+	var tErr *TemplateError
+	if assert.True(t, errors.As(err, &tErr)) {
+		assert.Equal(t, Position{File: "views/_components/broken.html", Line: 3}, tErr.Position)
+		assert.Equal(t, []Position{{File: "<string>", Line: 2}}, tErr.Callers)
+	}
+}
+
+func TestPropBindings(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/list.html": {Data: []byte(`<ul>{{ range .props.items }}<component type="item" :name=".Name" props-price="{{ .Price }}"></component>{{ end }}</ul>`)},
+		"views/_components/item.html": {Data: []byte(`{{ props }}
+	name  string required
+	price int
+{{ end }}
+<li>{{ .props.name }}: {{ printf "%T" .props.price }} {{ .props.price }}</li>`)},
+		"views/_components/title.html": {Data: []byte(`<h1>{{ .props.title }} ({{ len .props.items }})</h1>`)},
+	}
+
+	type product struct {
+		Name  string
+		Price int
+	}
+	data := map[string]interface{}{
+		"Title":    "Products",
+		"Products": []product{{"pen", 2}, {"book", 10}},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+
+	tests := []renderCase{
+		{
+			name:     "nested",
+			src:      `<component type="list" :items=".Products"></component>`,
+			expected: "<ul><li>pen: int 2</li>\n<li>book: int 10</li>\n</ul>\n",
+		},
+		{
+			name:     "untyped",
+			src:      `<component type="title" props-title="{{ .Title }}" :items='index . "Products"'></component>`,
+			expected: `<h1>Products (2)</h1>` + "\n",
+		},
+		{
+			name: "empty",
+			src:  `<component type="title" :title=" "></component>`,
+			err:  `component title: prop title is bound to an empty expression`,
+		},
+		{
+			name: "twice",
+			src:  `<component type="title" title="a" :title=".Title"></component>`,
+			err:  `component title: prop title is set twice`,
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+}
@@ -0,0 +1,152 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+/*
+	components can be registered instead of being read from the components folder,
+	a registered component replaces the file with the same name
+
+	xt.RegisterComponent("badge", `<span class="badge">{{.props.label}}</span>`)
+	xt.RegisterComponent("card", xtemplate.ComponentFunc(func(ctx context.Context, c xtemplate.ComponentArgs) (template.HTML, error) {
+		return template.HTML("<div>" + c.Slots["default"] + "</div>"), nil
+	}))
+
+	the slots of a Go component are rendered, in the scope of the component tag,
+	before the component is called
+*/
+
+// ComponentArgs are the values a Go component is rendered with
+type ComponentArgs struct {
+	// Data is the data of the template using the component (.ctx)
+	Data interface{}
+	// Props are the props set by the attributes of the component tag (.props)
+	Props map[string]interface{}
+	// Slots holds the rendered content of the slots, the content of a
+	// component tag without slots is the default slot
+	Slots map[string]template.HTML
+}
+
+// Component is a component implemented in Go
+type Component interface {
+	Render(ctx context.Context, args ComponentArgs) (template.HTML, error)
+}
+
+// ComponentFunc is a function used as a Component
+type ComponentFunc func(ctx context.Context, args ComponentArgs) (template.HTML, error)
+
+func (f ComponentFunc) Render(ctx context.Context, args ComponentArgs) (template.HTML, error) {
+	return f(ctx, args)
+}
+
+// RegisterComponent registers component name, impl is the template of the
+// component (a string) or a Component. it panics if impl is neither.
+// must be called before templates are parsed
+func (s *XTemplate) RegisterComponent(name string, impl interface{}) *XTemplate {
+	switch impl.(type) {
+	case string, Component:
+	default:
+		panic(fmt.Sprintf("xtemplate: component %s: %T isn't a string or a Component", name, impl))
+	}
+
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+
+	s.components[componentName(name)] = impl
+	return s
+}
+
+// component returns the implementation of registered component name
+func (s *XTemplate) component(name string) (interface{}, bool) {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	impl, found := s.components[name]
+	return impl, found
+}
+
+// hasGoComponents reports whether a Go component is registered
+func (s *XTemplate) hasGoComponents() bool {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	for _, impl := range s.components {
+		if _, ok := impl.(Component); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registeredComponent returns the template and the source name of registered component
+// tag (the cCount'th component of the template). the template of a Go component defines
+// the slots of tag and calls the component with them
+func registeredComponent(st *parseState, d delims, tag *Tag, slots []Tag, cCount int, impl interface{}) ([]byte, string) {
+	if content, ok := impl.(string); ok {
+		name := fmt.Sprintf("<component %s>", tag.ID)
+		st.addSource(name, []byte(content), nil, nil)
+		return []byte(content), name
+	}
+
+	var names []string
+	for _, slot := range slots {
+		names = append(names, slot.Name)
+	}
+	if len(slots) == 0 && strings.TrimSpace(tag.Body) != "" {
+		names = append(names, "default")
+	}
+
+	// the slot blocks are defined but not executed
+	b := bytes.NewBufferString(d.action("if false"))
+	args := fmt.Sprintf("%q . %q", tag.ID, fmt.Sprintf("%s__%d__", tag.blockID(), cCount))
+	for _, name := range names {
+		b.WriteString(d.action("block %q .", "#slot--"+name) + d.action("end"))
+		args += fmt.Sprintf(" %q", name)
+	}
+	b.WriteString(d.action("end") + d.action("renderComponent %s", args))
+
+	return b.Bytes(), ""
+}
+
+// componentFunc returns the renderComponent function of tpl: it renders the slots of a
+// Go component, named prefix + slot name in tpl, and calls the component with ctx
+func (s *XTemplate) componentFunc(ctx context.Context, tpl *template.Template) interface{} {
+	return func(name string, args map[string]interface{}, prefix string, slots ...string) (template.HTML, error) {
+		impl, _ := s.component(name)
+		c, ok := impl.(Component)
+		if !ok || tpl == nil {
+			return "", fmt.Errorf("component %s isn't a Go component", name)
+		}
+
+		cArgs := ComponentArgs{Data: args["ctx"], Slots: map[string]template.HTML{}}
+		if cArgs.Props, ok = args["props"].(map[string]interface{}); !ok {
+			cArgs.Props = map[string]interface{}{}
+		}
+
+		for _, slot := range slots {
+			buff := bytes.NewBufferString("")
+			if err := tpl.ExecuteTemplate(buff, prefix+slot, args); err != nil {
+				return "", err
+			}
+			cArgs.Slots[slot] = template.HTML(buff.String())
+		}
+
+		return c.Render(ctx, cArgs)
+	}
+}
+
+// bindComponents binds the functions executing the templates of tpl, renderComponent
+// (to ctx) and caller, to tpl. a caller function registered by the user isn't replaced
+func (s *XTemplate) bindComponents(ctx context.Context, tpl *template.Template) *template.Template {
+	funcs := template.FuncMap{"renderComponent": s.componentFunc(ctx, tpl)}
+	if !s.userFunc("caller") {
+		funcs["caller"] = s.callerFunc(tpl)
+	}
+	return tpl.Funcs(funcs)
+}
@@ -0,0 +1,72 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterComponent(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/badge.html": {Data: []byte(`<span>file</span>`)},
+		"views/page.html": {Data: []byte(`<component type="card" title="hi">
+	<slot name="header"><component type="badge" :label=".props.title"></component></slot>
+	<slot name="footer">{{ upper .ctx.name }}</slot>
+</component>`)},
+	}
+
+	card := ComponentFunc(func(ctx context.Context, c ComponentArgs) (template.HTML, error) {
+		data := c.Data.(map[string]interface{})
+		return template.HTML(fmt.Sprintf("<div title=%q user=%q>%s|%s|%v</div>",
+			c.Props["title"], data["name"], c.Slots["header"], c.Slots["footer"], ctx.Value(ctxKey("lang")))), nil
+	})
+	wrap := ComponentFunc(func(ctx context.Context, c ComponentArgs) (template.HTML, error) {
+		return "<section>" + c.Slots["default"] + "</section>", nil
+	})
+
+	xt := New(Config{FS: fsys, RootFolder: "views"}).
+		RegisterComponent("badge", `<b>{{ .props.label }}</b>`).
+		RegisterComponent("card", card).
+		RegisterComponent("wrap", wrap)
+	data := map[string]interface{}{"name": "<dinma>"}
+
+	tests := []renderCase{
+		{
+			name:     "string",
+			src:      `<component type="badge" label="new"></component>`,
+			expected: "<b>new</b>\n",
+		},
+		{
+			name:     "default slot",
+			src:      `<component type="wrap">{{ .ctx.name }}</component>`,
+			expected: "<section>&lt;dinma&gt;</section>\n",
+		},
+		{
+			name:     "empty",
+			src:      `<component type="wrap"></component>`,
+			expected: "<section></section>\n",
+		},
+	}
+
+	renderCases(t, xt, data, tests)
+
+	// slots, props, data and context
+	ctx := context.WithValue(context.Background(), ctxKey("lang"), "en")
+	buff := bytes.NewBufferString("")
+	assert.NoError(t, xt.RenderContext(ctx, buff, "page", data))
+	assert.Equal(t, `<div title="hi" user="<dinma>"><b>hi</b>
+|&lt;DINMA&gt;|en</div>
+`, buff.String())
+
+	buff.Reset()
+	assert.NoError(t, xt.Render(buff, "page", data, false))
+	assert.Contains(t, buff.String(), "|&lt;DINMA&gt;|<nil></div>")
+
+	assert.Panics(t, func() { xt.RegisterComponent("bad", 1) })
+}
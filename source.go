@@ -0,0 +1,294 @@
+package xtemplate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+	The preprocessor rewrites a template before it is parsed, so line numbers
+	reported by text/template refer to the rewritten text. Every rewrite keeps
+	a srcMap, the origin of each line of the rewritten text, which is used to
+	report errors against the original files.
+
+	Inlined component templates are mapped to the component file, with the
+	position of the component tag as the caller
+*/
+
+// srcPos is the origin of a line of a preprocessed template
+type srcPos struct {
+	file string
+	line int
+	// caller is the position of the component tag when the
+	// line comes from an inlined component template
+	caller *srcPos
+}
+
+// srcMap holds the origin of each line of a document
+type srcMap []*srcPos
+
+// newSrcMap maps each line of content to its line number in file
+func newSrcMap(file string, content []byte, caller *srcPos) srcMap {
+	m := make(srcMap, bytes.Count(content, []byte("\n"))+1)
+	for i := range m {
+		m[i] = &srcPos{file: file, line: i + 1, caller: caller}
+	}
+
+	return m
+}
+
+// ensure returns m, or a new map of src if m is nil
+func (m srcMap) ensure(src []byte) srcMap {
+	if m == nil {
+		return newSrcMap("", src, nil)
+	}
+
+	return m
+}
+
+// at returns the origin of the line containing offset pos of src
+func (m srcMap) at(src []byte, pos int) *srcPos {
+	return m[bytes.Count(src[:pos], []byte("\n"))]
+}
+
+// lines returns the origins of the lines spanned by src[start:end]
+func (m srcMap) lines(src []byte, start, end int) srcMap {
+	ls := bytes.Count(src[:start], []byte("\n"))
+	le := ls + bytes.Count(src[start:end], []byte("\n"))
+	return m[ls : le+1]
+}
+
+// spread maps the lines of text, which replaces the lines of m, to m.
+// when the number of lines differ the extra lines are mapped to the last line of m
+func (m srcMap) spread(text []byte) srcMap {
+	n := bytes.Count(text, []byte("\n")) + 1
+	if n == len(m) {
+		return m
+	}
+
+	retv := make(srcMap, n)
+	for i := range retv {
+		if i < len(m) {
+			retv[i] = m[i]
+		} else {
+			retv[i] = m[len(m)-1]
+		}
+	}
+
+	return retv
+}
+
+// docBuilder builds a document and its srcMap
+type docBuilder struct {
+	buf bytes.Buffer
+	m   srcMap
+}
+
+// write appends text, whose lines originate from m, to the document.
+// a line continued by text keeps its origin
+func (b *docBuilder) write(text []byte, m srcMap) {
+	if len(text) == 0 {
+		return
+	}
+
+	switch {
+	case len(b.m) == 0:
+		b.m = append(b.m, m...)
+	case bytes.HasSuffix(b.buf.Bytes(), []byte("\n")):
+		b.m[len(b.m)-1] = m[0]
+		b.m = append(b.m, m[1:]...)
+	default:
+		b.m = append(b.m, m[1:]...)
+	}
+
+	b.buf.Write(text)
+}
+
+// copy appends src[start:end] to the document
+func (b *docBuilder) copy(src []byte, m srcMap, start, end int) {
+	b.write(src[start:end], m.lines(src, start, end))
+}
+
+// replace appends repl, which replaces src[start:end], to the document.
+// the lines of repl are mapped to replMap or to the replaced lines if replMap is nil
+func (b *docBuilder) replace(src []byte, m srcMap, start, end int, repl []byte, replMap srcMap) {
+	if replMap == nil {
+		replMap = m.lines(src, start, end).spread(repl)
+	}
+
+	b.write(repl, replMap)
+}
+
+func (b *docBuilder) result() ([]byte, srcMap) {
+	if len(b.m) == 0 {
+		return b.buf.Bytes(), srcMap{{}}
+	}
+
+	return b.buf.Bytes(), b.m
+}
+
+// splice replaces src[start:end] with repl
+func splice(src []byte, m srcMap, start, end int, repl []byte, replMap srcMap) ([]byte, srcMap) {
+	b := docBuilder{}
+	b.copy(src, m, 0, start)
+	b.replace(src, m, start, end, repl, replMap)
+	b.copy(src, m, end, len(src))
+
+	return b.result()
+}
+
+// replaceAllFunc is regexp.ReplaceAllFunc for a mapped document
+func replaceAllFunc(re *regexp.Regexp, src []byte, m srcMap, fn func([]byte) []byte) ([]byte, srcMap) {
+	m = m.ensure(src)
+	b := docBuilder{}
+	pos := 0
+
+	for _, loc := range re.FindAllIndex(src, -1) {
+		b.copy(src, m, pos, loc[0])
+		b.replace(src, m, loc[0], loc[1], fn(src[loc[0]:loc[1]]), nil)
+		pos = loc[1]
+	}
+	b.copy(src, m, pos, len(src))
+
+	return b.result()
+}
+
+// sources records the original and preprocessed text of the
+// files used to build a template
+type sources struct {
+	// names maps the name a file was parsed under to the file
+	names map[string]string
+	files map[string]*sourceFile
+}
+
+type sourceFile struct {
+	original  []byte
+	processed []byte
+	m         srcMap
+}
+
+func newSources() *sources {
+	return &sources{names: map[string]string{}, files: map[string]*sourceFile{}}
+}
+
+// add records the original and preprocessed content of file
+func (s *sources) add(file string, original, processed []byte, m srcMap) {
+	s.files[file] = &sourceFile{original: original, processed: processed, m: m}
+}
+
+// parse parses the preprocessed content of file into t under name
+func (s *sources) parse(t *template.Template, name, file string, content []byte) (*template.Template, error) {
+	s.names[name] = file
+
+	tpl, err := t.Parse(string(content))
+	if err != nil {
+		return nil, s.wrap(err)
+	}
+
+	return tpl, nil
+}
+
+// (html/)template: name:line:col: description
+var errLocationRe = regexp.MustCompile(`(?s)^(?:html/)?template: ?([^:\n]*):(\d+):(?:(\d+):)? ?(.*)$`)
+
+// executing "name" at <.Field>: description
+var errContextRe = regexp.MustCompile(`at <(.+?)>: `)
+
+// wrap converts a parse or exec error into a *TemplateError
+// that refers to the original source of the template
+func (s *sources) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*TemplateError); ok {
+		return err
+	}
+
+	parts := errLocationRe.FindStringSubmatch(err.Error())
+	if parts == nil {
+		return err
+	}
+
+	name := parts[1]
+	file, found := s.names[name]
+	if !found {
+		return err
+	}
+	src := s.files[file]
+
+	line, _ := strconv.Atoi(parts[2])
+	if line < 1 || line > len(src.m) {
+		return err
+	}
+
+	pos := src.m[line-1]
+	tErr := &TemplateError{
+		Name:        name,
+		Position:    Position{File: pos.file, Line: pos.line},
+		Description: parts[4],
+		Err:         err,
+	}
+
+	// map the column
+	if parts[3] != "" {
+		col, _ := strconv.Atoi(parts[3])
+		orig := s.line(pos.file, pos.line)
+		if orig == sourceLine(src.processed, line) {
+			tErr.Col = col + 1
+		} else if ctx := errContextRe.FindStringSubmatch(parts[4]); ctx != nil &&
+			strings.Count(orig, ctx[1]) == 1 {
+			tErr.Col = strings.Index(orig, ctx[1]) + 1
+		}
+	}
+
+	tErr.Callers = pos.callers()
+
+	return tErr
+}
+
+// callers returns the positions of the component tags the line at p was inlined by
+func (p *srcPos) callers() []Position {
+	var retv []Position
+	for c := p.caller; c != nil; c = c.caller {
+		retv = append(retv, Position{File: c.file, Line: c.line})
+	}
+
+	return retv
+}
+
+// newTemplateError returns an error found by the preprocessor at pos
+func newTemplateError(pos *srcPos, format string, args ...interface{}) *TemplateError {
+	desc := fmt.Sprintf(format, args...)
+	return &TemplateError{
+		Position:    Position{File: pos.file, Line: pos.line},
+		Callers:     pos.callers(),
+		Description: desc,
+		Err:         errors.New(desc),
+	}
+}
+
+// line returns line n of the original content of file
+func (s *sources) line(file string, n int) string {
+	src, found := s.files[file]
+	if !found {
+		return ""
+	}
+
+	return sourceLine(src.original, n)
+}
+
+// sourceLine returns line n (starting from 1) of content
+func sourceLine(content []byte, n int) string {
+	lines := bytes.Split(content, []byte("\n"))
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+
+	return string(lines[n-1])
+}
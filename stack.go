@@ -0,0 +1,172 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"text/template/parse"
+)
+
+/*
+	templates and components push content to named stacks, a stack is rendered
+	where {{ stack "name" }} is used, even if the content is pushed after it
+
+	layout.html:    <head>{{ stack "styles" }}</head><body>{{block "body" .}}{{end}}</body>
+	_components/card.html:
+		{{ push "styles" "card" }}<link rel="stylesheet" href="/card.css">{{ end }}
+		<div class="card">...</div>
+
+	content pushed with the same key (the content itself when a key isn't given)
+	is added to a stack once.
+
+	{{ push "name" }} is translated to {{ if push "name" }} and the if actions are
+	replaced, once parsed, by the action and its content followed by {{ pushEnd }}.
+	push, pushEnd and stack write markers which are resolved once the template is executed.
+	the markers are made of letters, digits and underscores (names and keys are hex encoded)
+	and typed template.JS so that html/template writes them unchanged in every context:
+	html text, attribute values, urls, <style> and <script>
+*/
+
+const (
+	pushMarker    = "xtpl_push_"
+	pushEndMarker = "xtpl_pushend_"
+	stackMarker   = "xtpl_stack_"
+)
+
+// xtpl_push_<name>_<key>_content xtpl_pushend_
+var pushedRe = regexp.MustCompile(`(?s)xtpl_push_([0-9a-f]*)_([0-9a-f]*)_(.*?)xtpl_pushend_`)
+
+// xtpl_stack_<name>_
+var stackMarkerRe = regexp.MustCompile(`xtpl_stack_([0-9a-f]*)_`)
+
+// pushFunc marks the start of the content pushed to stack name
+func pushFunc(name string, key ...string) (template.JS, error) {
+	if len(key) > 1 {
+		return "", fmt.Errorf("push %s: too many keys", name)
+	}
+
+	k := ""
+	if len(key) > 0 {
+		k = key[0]
+	}
+	return template.JS(fmt.Sprintf("%s%x_%x_", pushMarker, name, k)), nil
+}
+
+// pushEnd marks the end of pushed content
+func pushEnd() template.JS {
+	return pushEndMarker
+}
+
+// stackFunc marks where stack name is rendered
+func stackFunc(name string) template.JS {
+	return template.JS(fmt.Sprintf("%s%x_", stackMarker, name))
+}
+
+// translatePush converts {{ push "name" }} into {{ if push "name" }}
+func (sx *syntax) translatePush(src []byte, m srcMap) ([]byte, srcMap) {
+	return replaceAllFunc(sx.pushRe, src, m, func(b []byte) []byte {
+		parts := sx.pushRe.FindSubmatch(b)
+		return []byte(sx.action("%sif push%s", parts[1], parts[2]))
+	})
+}
+
+// usesStacks reports whether src pushes content or renders a stack
+func (sx *syntax) usesStacks(src []byte) bool {
+	return sx.stacksRe.Match(src)
+}
+
+// resolvePushes replaces the {{ if push "name" }} actions of t's templates
+// with the push action and its content followed by {{ pushEnd }}
+func resolvePushes(t *template.Template) error {
+	for _, tpl := range t.Templates() {
+		if tpl.Tree == nil {
+			continue
+		}
+
+		for _, n := range findPushes(tpl.Tree.Root, nil) {
+			if n.ElseList != nil {
+				return fmt.Errorf("template: %s:%d: push can't have an else", tpl.Tree.ParseName, n.Line)
+			}
+
+			list := &parse.ListNode{NodeType: parse.NodeList, Pos: n.Pos}
+			list.Nodes = append(list.Nodes, &parse.ActionNode{NodeType: parse.NodeAction, Pos: n.Pos, Line: n.Line, Pipe: n.Pipe})
+			if n.List != nil {
+				list.Nodes = append(list.Nodes, n.List.Nodes...)
+			}
+			list.Nodes = append(list.Nodes, pushEndNode(tpl.Tree, n))
+
+			replaceNode(tpl.Tree.Root, n, list)
+		}
+	}
+
+	return nil
+}
+
+// findPushes returns the {{ if push "name" }} actions within list
+func findPushes(list *parse.ListNode, found []*parse.IfNode) []*parse.IfNode {
+	if list == nil {
+		return found
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			if isPush(n) {
+				found = append(found, n)
+			}
+			found = findPushes(n.List, findPushes(n.ElseList, found))
+		case *parse.RangeNode:
+			found = findPushes(n.List, findPushes(n.ElseList, found))
+		case *parse.WithNode:
+			found = findPushes(n.List, findPushes(n.ElseList, found))
+		case *parse.ListNode:
+			found = findPushes(n, found)
+		}
+	}
+
+	return found
+}
+
+// isPush reports whether the action is {{ if push ... }}
+func isPush(n *parse.IfNode) bool {
+	if n.Pipe == nil || len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) != 1 || len(n.Pipe.Cmds[0].Args) < 2 {
+		return false
+	}
+
+	ident, ok := n.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "push"
+}
+
+// pushEndNode returns {{ pushEnd }}, of tree, positioned at n
+func pushEndNode(tree *parse.Tree, n *parse.IfNode) *parse.ActionNode {
+	ident := parse.NewIdentifier("pushEnd").SetTree(tree).SetPos(n.Pos)
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}}
+	pipe := &parse.PipeNode{NodeType: parse.NodePipe, Pos: n.Pos, Line: n.Line, Cmds: []*parse.CommandNode{cmd}}
+
+	return &parse.ActionNode{NodeType: parse.NodeAction, Pos: n.Pos, Line: n.Line, Pipe: pipe}
+}
+
+// resolveStacks moves the content pushed within out to the stacks it was pushed to
+func resolveStacks(out []byte) []byte {
+	stacks := map[string][][]byte{}
+	seen := map[string]bool{}
+
+	out = pushedRe.ReplaceAllFunc(out, func(b []byte) []byte {
+		parts := pushedRe.FindSubmatch(b)
+		name, key, content := string(parts[1]), string(parts[2]), parts[3]
+		if key == "" {
+			key = string(content)
+		}
+
+		if !seen[name+"\x00"+key] {
+			seen[name+"\x00"+key] = true
+			stacks[name] = append(stacks[name], content)
+		}
+		return nil
+	})
+
+	return stackMarkerRe.ReplaceAllFunc(out, func(b []byte) []byte {
+		return bytes.Join(stacks[string(stackMarkerRe.FindSubmatch(b)[1])], nil)
+	})
+}
@@ -0,0 +1,78 @@
+package xtemplate
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStacks(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/layout.html": {Data: []byte(`<head>{{ stack "styles" }}</head><body>{{block "body" .}}{{end}}</body>{{ stack "scripts" }}`)},
+		"views/_components/card.html": {Data: []byte(`{{- push "styles" "card" -}}<link href="/card.css">{{- end -}}
+<div>{{block "#slot--default" .}}{{end}}</div>`)},
+		"views/page.html": {Data: []byte(`{{extends "layout.html"}}
+{{define "body"}}<x-card>a</x-card><x-card>b</x-card>{{ range .scripts }}{{ push "scripts" }}<script src="{{ . }}"></script>{{ end }}{{ end }}{{end}}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views"})
+	data := map[string]interface{}{"scripts": []string{"/a.js", "/b.js", "/a.js"}}
+
+	buff := bytes.NewBufferString("")
+	assert.NoError(t, xt.Render(buff, "page", data, false))
+	assert.Equal(t, `<head><link href="/card.css"></head><body><div>a</div>
+<div>b</div>
+</body><script src="/a.js"></script><script src="/b.js"></script>`, buff.String())
+
+	tests := []renderCase{
+		{
+			name:     "scope",
+			src:      `{{ $n := "x" }}<p>{{ push "s" }}[{{ $n }}]{{ end }}</p>{{ stack "s" }}`,
+			expected: `<p></p>[x]`,
+		},
+		{
+			name:     "unknown stack",
+			src:      `{{ stack "s" }}<p>{{ push "t" }}t{{ end }}</p>`,
+			expected: `<p></p>`,
+		},
+		{
+			name:     "style",
+			src:      `<style>{{ stack "css" }}</style>{{ push "css" }}.a{color:red}{{ end }}`,
+			expected: `<style>.a{color:red}</style>`,
+		},
+		{
+			name:     "script",
+			src:      `<script>{{ stack "js" }}</script>{{ push "js" }}var a = "a";{{ end }}`,
+			expected: `<script>var a = "a";</script>`,
+		},
+		{
+			name:     "pushed within script",
+			src:      `<head>{{ stack "js" }}</head><script>{{ push "js" }}var a = 1;{{ end }}</script>`,
+			expected: `<head>var a = 1;</head><script></script>`,
+		},
+		{
+			name:     "attribute",
+			src:      `<p class="{{ stack "class" }}">{{ push "class" }}a{{ end }}</p>`,
+			expected: `<p class="a"></p>`,
+		},
+		{
+			name:    "else",
+			src:     `{{ push "s" }}a{{ else }}b{{ end }}`,
+			wantErr: true,
+		},
+	}
+
+	renderCases(t, xt, nil, tests)
+}
+
+func TestResolvePushesWithoutState(t *testing.T) {
+	var st *parseState
+	tpl := template.New("x").Funcs(template.FuncMap{"push": pushFunc})
+
+	_, err := st.parse(tpl, "x", []byte(`{{ if push "s" }}a{{ else }}b{{ end }}`))
+	assert.EqualError(t, err, "template: x:1: push can't have an else")
+}
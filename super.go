@@ -0,0 +1,144 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"text/template/parse"
+)
+
+/*
+	{{ super }} within a block overriding a block of the master template renders
+	the master's version of the block.
+
+	master.html: {{block "body" .}}<p>master</p>{{end}}
+	page.html:   {{extends "master.html"}}{{define "body"}}{{ super }}<p>page</p>{{end}}
+
+	the master's block is renamed (body__super_1) and {{ super }} is replaced with
+	{{ template "body__super_1" . }}. the chain can be any number of levels deep
+*/
+
+// superFunc is called by {{ super }} actions that haven't been resolved
+// i.e. those used outside of a block overriding a master's block
+func superFunc() (string, error) {
+	return "", fmt.Errorf("super used outside of a block overriding a master template's block")
+}
+
+// parseOverlay parses content, the content of file which extends master, into master
+// under name and resolves the {{ super }} actions of the blocks it overrides
+func (s *XTemplate) parseOverlay(st *parseState, master *template.Template, name, file string, content []byte) error {
+	parents := map[string]*parse.Tree{}
+	for _, t := range master.Templates() {
+		parents[t.Name()] = t.Tree
+	}
+
+	if _, err := st.parse(master.New(name), file, content); err != nil {
+		return err
+	}
+
+	for _, t := range master.Templates() {
+		parent := parents[t.Name()]
+		if t.Tree == nil || t.Tree == parent {
+			// not defined by the overlay
+			continue
+		}
+
+		supers := findSuper(t.Tree.Root, nil)
+		if len(supers) == 0 {
+			continue
+		}
+
+		if parent == nil || parent.Root == nil {
+			err := fmt.Errorf("template: %s:%d: super used in %q which doesn't override a block of its master template",
+				t.Tree.ParseName, supers[0].Line, t.Name())
+			return st.src.wrap(err)
+		}
+
+		// add the master's version of the block under a new name
+		superName := ""
+		for n := 1; superName == "" || master.Lookup(superName) != nil; n++ {
+			superName = fmt.Sprintf("%s__super_%d", t.Name(), n)
+		}
+		if _, err := master.AddParseTree(superName, parent); err != nil {
+			return err
+		}
+
+		for _, action := range supers {
+			replaceNode(t.Tree.Root, action, superTemplateNode(action, superName))
+		}
+	}
+
+	return nil
+}
+
+// findSuper returns the {{ super }} actions within list
+func findSuper(list *parse.ListNode, found []*parse.ActionNode) []*parse.ActionNode {
+	if list == nil {
+		return found
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			if isSuper(n) {
+				found = append(found, n)
+			}
+		case *parse.IfNode:
+			found = findSuper(n.List, findSuper(n.ElseList, found))
+		case *parse.RangeNode:
+			found = findSuper(n.List, findSuper(n.ElseList, found))
+		case *parse.WithNode:
+			found = findSuper(n.List, findSuper(n.ElseList, found))
+		case *parse.ListNode:
+			found = findSuper(n, found)
+		}
+	}
+
+	return found
+}
+
+// isSuper reports whether the action is {{ super }}
+func isSuper(n *parse.ActionNode) bool {
+	if n.Pipe == nil || len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) != 1 || len(n.Pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+
+	ident, ok := n.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "super"
+}
+
+// replaceNode replaces old with node within list
+func replaceNode(list *parse.ListNode, old, node parse.Node) {
+	if list == nil {
+		return
+	}
+
+	for i, n := range list.Nodes {
+		if n == old {
+			list.Nodes[i] = node
+			continue
+		}
+
+		switch n := n.(type) {
+		case *parse.IfNode:
+			replaceNode(n.List, old, node)
+			replaceNode(n.ElseList, old, node)
+		case *parse.RangeNode:
+			replaceNode(n.List, old, node)
+			replaceNode(n.ElseList, old, node)
+		case *parse.WithNode:
+			replaceNode(n.List, old, node)
+			replaceNode(n.ElseList, old, node)
+		case *parse.ListNode:
+			replaceNode(n, old, node)
+		}
+	}
+}
+
+// superTemplateNode returns {{ template "name" . }} positioned at the super action
+func superTemplateNode(action *parse.ActionNode, name string) *parse.TemplateNode {
+	dot := &parse.DotNode{NodeType: parse.NodeDot, Pos: action.Pos}
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: action.Pos, Args: []parse.Node{dot}}
+	pipe := &parse.PipeNode{NodeType: parse.NodePipe, Pos: action.Pos, Line: action.Line, Cmds: []*parse.CommandNode{cmd}}
+
+	return &parse.TemplateNode{NodeType: parse.NodeTemplate, Pos: action.Pos, Line: action.Line, Name: name, Pipe: pipe}
+}
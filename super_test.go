@@ -0,0 +1,74 @@
+package xtemplate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuper(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/base.html":    {Data: []byte(`<body>{{block "body" .}}<p>base {{.name}}</p>{{end}}</body>{{block "footer" .}}base{{end}}`)},
+		"views/master.html":  {Data: []byte(`{{extends "base.html"}}{{define "body"}}{{ super }}<p>master</p>{{end}}`)},
+		"views/overlay.html": {Data: []byte(`{{extends "master.html"}}{{define "body"}}<p>overlay</p>{{ if .name }}{{- super -}}{{ end }}{{end}}`)},
+		"views/footer.html":  {Data: []byte(`{{extends "master.html"}}{{define "footer"}}{{super}} & footer{{end}}`)},
+		"views/twice.html":   {Data: []byte(`{{extends "base.html"}}{{define "body"}}{{super}}{{super}}{{end}}`)},
+		"views/new.html": {Data: []byte(`{{extends "base.html"}}
+{{define "sidebar"}}{{ super }}{{end}}`)},
+		"views/plain.html": {Data: []byte(`{{ super }}`)},
+		"views/broken.html": {Data: []byte(`<body>{{block "body" .}}
+{{ index .list 5 }}{{end}}</body>`)},
+		"views/child.html": {Data: []byte(`{{extends "broken.html"}}{{define "body"}}{{ super }}{{end}}`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views", Ext: "html"})
+	data := map[string]interface{}{"name": "<b>", "list": []int{}}
+
+	tests := []struct {
+		name     string
+		tpl      string
+		expected string
+		wantErr  bool
+	}{
+		{name: "one level", tpl: "master", expected: "<body><p>base &lt;b&gt;</p><p>master</p></body>base"},
+		{name: "two levels", tpl: "overlay", expected: "<body><p>overlay</p><p>base &lt;b&gt;</p><p>master</p></body>base"},
+		{name: "other block", tpl: "footer", expected: "<body><p>base &lt;b&gt;</p><p>master</p></body>base & footer"},
+		{name: "twice", tpl: "twice", expected: "<body><p>base &lt;b&gt;</p><p>base &lt;b&gt;</p></body>base"},
+		{name: "no parent block", tpl: "new", wantErr: true},
+		{name: "no master", tpl: "plain", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := bytes.NewBufferString("")
+			err := xt.Render(buff, tt.tpl, data, false)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, buff.String())
+		})
+	}
+
+	// errors refer to the file and line of super's block
+	var tErr *TemplateError
+	err := xt.Render(bytes.NewBufferString(""), "new", data, false)
+	if assert.True(t, errors.As(err, &tErr), "%v", err) {
+		assert.Equal(t, Position{File: "views/new.html", Line: 2}, tErr.Position)
+	}
+
+	err = xt.Render(bytes.NewBufferString(""), "child", data, false)
+	if assert.True(t, errors.As(err, &tErr), "%v", err) {
+		assert.Equal(t, Position{File: "views/broken.html", Line: 2, Col: 4}, tErr.Position)
+	}
+
+	retv, err := xt.RenderString(`{{extends "base.html"}}{{define "footer"}}[{{ super }}]{{end}}`, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "<body><p>base &lt;b&gt;</p></body>[base]", retv)
+}
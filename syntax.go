@@ -0,0 +1,476 @@
+package xtemplate
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	translateFuncSyntax rewrites the function call syntax sugar within actions
+	into standard text/template syntax. An operand (a function name, method or
+	variable) immediately followed by an opening parenthesis is a call
+
+	{{ fn(a, b) }}                 --> {{ fn a b }}
+	{{ upper(lower(.x)) }}         --> {{ upper (lower .x) }}
+	{{ .User.Name(1, 2) }}         --> {{ .User.Name 1 2 }}
+	{{ printf("%d", len .x) }}     --> {{ printf "%d" (len .x) }}
+	{{ lower(.x) | printf("%s") }} --> {{ lower .x | printf "%s" }}
+	{{ .Get("a").Name }}           --> {{ (.Get "a").Name }}
+
+	actions are tokenized so string, raw string and character literals,
+	comments and parenthesized pipelines are left untouched
+*/
+
+type tokenType int
+
+const (
+	tokSpace    tokenType = iota
+	tokString             // "abc", `abc` or 'a'
+	tokNumber             // 123, -1.5, 0x1F
+	tokIdent              // function name or keyword
+	tokField              // .Field, .Field.Method or .
+	tokVariable           // $, $x or $x.Field
+	tokLParen             // (
+	tokRParen             // )
+	tokComma              // ,
+	tokPipe               // |
+	tokAssign             // := or =
+	tokOther
+)
+
+type token struct {
+	typ  tokenType
+	text string
+}
+
+// keywords can't be called using the function syntax
+var keywords = []string{
+	"if", "else", "end", "range", "with", "define", "block", "template",
+	"break", "continue", "nil", "true", "false",
+}
+
+// delims are the action delimiters used by the preprocessor
+type delims struct {
+	left  string
+	right string
+}
+
+var defaultDelims = delims{left: "{{", right: "}}"}
+
+// translateFuncSyntax
+// fn(arg1, arg2,...) --> fn arg1 arg2 ...
+func translateFuncSyntax(src []byte, m srcMap) ([]byte, srcMap) {
+	return defaultDelims.translateFuncSyntax(src, m)
+}
+
+func (d delims) translateFuncSyntax(src []byte, m srcMap) ([]byte, srcMap) {
+	m = m.ensure(src)
+	out := docBuilder{}
+	pos := 0
+
+	for {
+		start := bytes.Index(src[pos:], []byte(d.left))
+		if start < 0 {
+			break
+		}
+		start += pos
+
+		act, ok := d.scanAction(src, start)
+		if !ok {
+			// unterminated action, leave it for the parser to report
+			break
+		}
+
+		out.copy(src, m, pos, start)
+		out.replace(src, m, start, act.end, []byte(act.translate()), nil)
+		pos = act.end
+	}
+
+	out.copy(src, m, pos, len(src))
+	return out.result()
+}
+
+// action is a single {{ }} action found in a template
+type action struct {
+	src    string // the complete action including its delimiters
+	prefix string // left delimiter and trim marker
+	suffix string // trim marker and right delimiter
+	tokens []token
+	end    int // offset of the end of the action in the template
+}
+
+// scanAction tokenizes the action that starts at offset start of src
+func (d delims) scanAction(src []byte, start int) (*action, bool) {
+	pos := start + len(d.left)
+	if pos < len(src)-1 && src[pos] == '-' && isSpace(src[pos+1]) {
+		pos++
+	}
+
+	act := &action{prefix: string(src[start:pos])}
+
+	// comments are not tokenized
+	body := bytes.TrimLeft(src[pos:], " \t\r\n")
+	if bytes.HasPrefix(body, []byte("/*")) {
+		end := bytes.Index(body, []byte("*/"))
+		if end < 0 {
+			return nil, false
+		}
+		cPos := pos + (len(src[pos:]) - len(body)) + end + 2
+		rPos := bytes.Index(src[cPos:], []byte(d.right))
+		if rPos < 0 {
+			return nil, false
+		}
+		act.end = cPos + rPos + len(d.right)
+		act.src = string(src[start:act.end])
+		return act, true
+	}
+
+	for pos < len(src) {
+		rest := src[pos:]
+
+		if bytes.HasPrefix(rest, []byte(d.right)) {
+			act.suffix = d.right
+			act.end = pos + len(d.right)
+			act.src = string(src[start:act.end])
+			return act, true
+		}
+
+		if rest[0] == '-' && bytes.HasPrefix(rest[1:], []byte(d.right)) &&
+			len(act.tokens) > 0 && act.tokens[len(act.tokens)-1].typ == tokSpace {
+			act.suffix = "-" + d.right
+			act.end = pos + 1 + len(d.right)
+			act.src = string(src[start:act.end])
+			return act, true
+		}
+
+		tok, ok := lexToken(rest)
+		if !ok {
+			return nil, false
+		}
+
+		act.tokens = append(act.tokens, tok)
+		pos += len(tok.text)
+	}
+
+	return nil, false
+}
+
+// lexToken returns the token at the start of src
+func lexToken(src []byte) (token, bool) {
+	c := src[0]
+	switch {
+	case isSpace(c):
+		n := 1
+		for n < len(src) && isSpace(src[n]) {
+			n++
+		}
+		return token{tokSpace, string(src[:n])}, true
+
+	case c == '"' || c == '\'':
+		for n := 1; n < len(src); n++ {
+			switch src[n] {
+			case '\\':
+				n++
+			case '\n':
+				return token{}, false
+			case c:
+				return token{tokString, string(src[:n+1])}, true
+			}
+		}
+		return token{}, false
+
+	case c == '`':
+		n := bytes.IndexByte(src[1:], '`')
+		if n < 0 {
+			return token{}, false
+		}
+		return token{tokString, string(src[:n+2])}, true
+
+	case c == '(':
+		return token{tokLParen, "("}, true
+	case c == ')':
+		return token{tokRParen, ")"}, true
+	case c == ',':
+		return token{tokComma, ","}, true
+	case c == '|':
+		return token{tokPipe, "|"}, true
+	case c == ':' && len(src) > 1 && src[1] == '=':
+		return token{tokAssign, ":="}, true
+	case c == '=':
+		return token{tokAssign, "="}, true
+
+	case c == '.' && (len(src) == 1 || !isDigit(src[1])):
+		return token{tokField, string(src[:scanFields(src)])}, true
+
+	case c == '$':
+		n := 1 + scanIdent(src[1:])
+		n += scanFields(src[n:])
+		return token{tokVariable, string(src[:n])}, true
+
+	case isDigit(c) || c == '.' ||
+		((c == '-' || c == '+') && len(src) > 1 && (isDigit(src[1]) || src[1] == '.')):
+		n := 1
+		for n < len(src) {
+			b := src[n]
+			if isDigit(b) || isLetter(b) || b == '.' || b == '_' ||
+				((b == '-' || b == '+') && strings.ContainsRune("eEpP", rune(src[n-1]))) {
+				n++
+				continue
+			}
+			break
+		}
+		return token{tokNumber, string(src[:n])}, true
+	}
+
+	if n := scanIdent(src); n > 0 {
+		return token{tokIdent, string(src[:n])}, true
+	}
+
+	_, n := utf8.DecodeRune(src)
+	return token{tokOther, string(src[:n])}, true
+}
+
+// scanFields returns the length of the .Field chain at the start of src
+func scanFields(src []byte) int {
+	n := 0
+	for n < len(src) && src[n] == '.' {
+		n++
+		n += scanIdent(src[n:])
+	}
+
+	return n
+}
+
+// scanIdent returns the length of the identifier at the start of src
+func scanIdent(src []byte) int {
+	n := 0
+	for n < len(src) {
+		r, size := utf8.DecodeRune(src[n:])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		n += size
+	}
+
+	return n
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isCallee reports whether tok is an operand that can be called
+func (t token) isCallee() bool {
+	switch t.typ {
+	case tokField:
+		return t.text != "."
+	case tokVariable:
+		return strings.Contains(t.text, ".")
+	case tokIdent:
+		return !StrListIncludes(t.text, keywords)
+	}
+
+	return false
+}
+
+// hasCalls reports whether the action uses the function call syntax
+func (a *action) hasCalls() bool {
+	for i := 0; i+1 < len(a.tokens); i++ {
+		if a.tokens[i].isCallee() && a.tokens[i+1].typ == tokLParen {
+			return true
+		}
+	}
+
+	return false
+}
+
+// translate returns the action in standard text/template syntax
+func (a *action) translate() string {
+	if !a.hasCalls() {
+		return a.src
+	}
+
+	p := &callParser{tokens: a.tokens}
+	body, _ := p.parseSeq(false)
+	if p.failed || p.pos < len(p.tokens) {
+		// unbalanced parenthesis, leave it for the parser to report
+		return a.src
+	}
+
+	return a.prefix + body + a.suffix
+}
+
+// callParser converts the calls within a list of tokens
+type callParser struct {
+	tokens []token
+	pos    int
+	failed bool
+}
+
+func (p *callParser) peek(offset int) *token {
+	if p.pos+offset < len(p.tokens) {
+		return &p.tokens[p.pos+offset]
+	}
+
+	return nil
+}
+
+// nextSignificant returns the first non space token at or after the current position
+func (p *callParser) nextSignificant() *token {
+	for i := p.pos; i < len(p.tokens); i++ {
+		if p.tokens[i].typ != tokSpace {
+			return &p.tokens[i]
+		}
+	}
+
+	return nil
+}
+
+// parseSeq translates tokens until a closing parenthesis (or a comma when inArgs
+// is true) is reached. it returns the translated text and whether the sequence
+// is a single operand
+func (p *callParser) parseSeq(inArgs bool) (string, bool) {
+	var (
+		out      strings.Builder
+		operands int
+		// the last two significant tokens
+		prev, prev2 *token
+	)
+
+	commandStart := func() bool {
+		if prev == nil {
+			return true
+		}
+
+		switch prev.typ {
+		case tokPipe, tokAssign, tokLParen:
+			return true
+		case tokIdent:
+			return StrListIncludes(prev.text, []string{"if", "with", "range", "else"})
+		case tokString:
+			return prev2 != nil && prev2.typ == tokIdent &&
+				StrListIncludes(prev2.text, []string{"template", "block"})
+		}
+
+		return false
+	}
+
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+
+		if tok.typ == tokRParen || (inArgs && tok.typ == tokComma) {
+			break
+		}
+
+		switch {
+		case tok.typ == tokSpace:
+			out.WriteString(tok.text)
+			p.pos++
+			continue
+
+		case tok.typ == tokLParen:
+			p.pos++
+			inner, _ := p.parseSeq(false)
+			if p.peek(0) == nil {
+				p.failed = true
+				return out.String(), false
+			}
+			p.pos++
+			out.WriteString("(" + inner + ")")
+
+		case tok.isCallee() && p.peek(1) != nil && p.peek(1).typ == tokLParen:
+			start := commandStart()
+			p.pos += 2
+			call := p.parseCall(tok.text)
+			if p.failed {
+				return out.String(), false
+			}
+
+			// a method called on the result: .D.AddDate(1, 0, 0).Format("2006")
+			for p.peek(0) != nil && p.peek(0).typ == tokField && p.peek(1) != nil && p.peek(1).typ == tokLParen {
+				callee := "(" + call + ")" + p.peek(0).text
+				p.pos += 2
+				if call = p.parseCall(callee); p.failed {
+					return out.String(), false
+				}
+			}
+
+			next := p.nextSignificant()
+			chained := p.peek(0) != nil && p.peek(0).typ == tokField
+			whole := next == nil || next.typ == tokPipe || next.typ == tokRParen ||
+				(inArgs && next.typ == tokComma)
+			if !start || !whole || chained || inArgs {
+				call = "(" + call + ")"
+			}
+			out.WriteString(call)
+
+		default:
+			out.WriteString(tok.text)
+			p.pos++
+		}
+
+		operands++
+		prev2, prev = prev, &p.tokens[p.pos-1]
+		if prev.typ == tokRParen {
+			// treat the group or call as an operand
+			prev = &token{typ: tokOther}
+		}
+	}
+
+	return out.String(), operands == 1
+}
+
+// parseCall translates the arguments of a call, the opening parenthesis
+// has been consumed. callee arg1 arg2... is returned
+func (p *callParser) parseCall(callee string) string {
+	var out strings.Builder
+	out.WriteString(callee)
+	// line breaks between the arguments are kept so line numbers don't change
+	lines := 0
+
+	for {
+		arg, single := p.parseSeq(true)
+		tok := p.peek(0)
+		if tok == nil {
+			p.failed = true
+			return ""
+		}
+
+		trimmed := strings.TrimSpace(arg)
+		if trimmed == "" {
+			lines += strings.Count(arg, "\n")
+		} else {
+			lead := arg[:strings.Index(arg, trimmed)]
+			lines += strings.Count(lead, "\n")
+			if lines > 0 {
+				out.WriteString(strings.Repeat("\n", lines))
+			} else {
+				out.WriteString(" ")
+			}
+			lines = strings.Count(arg[len(lead)+len(trimmed):], "\n")
+
+			if !single {
+				trimmed = "(" + trimmed + ")"
+			}
+			out.WriteString(trimmed)
+		}
+
+		p.pos++
+		if tok.typ == tokRParen {
+			break
+		}
+	}
+
+	out.WriteString(strings.Repeat("\n", lines))
+	return out.String()
+}
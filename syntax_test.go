@@ -0,0 +1,85 @@
+package xtemplate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_translateFuncSyntax(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "no call", src: `{{ .name }} is {{ .age }}`, want: `{{ .name }} is {{ .age }}`},
+		{name: "no args", src: `{{ now() }}`, want: `{{ now }}`},
+		{name: "single arg", src: `{{ upper("hello") }}`, want: `{{ upper "hello" }}`},
+		{name: "multiple args", src: `{{ printf("%s is %d",.name, .age) }}`, want: `{{ printf "%s is %d" .name .age }}`},
+		{name: "comma in string", src: `{{ printf("a, b %s", .x) }}`, want: `{{ printf "a, b %s" .x }}`},
+		{name: "parenthesis in string", src: `{{ printf("(a) %s)", .x) }}`, want: `{{ printf "(a) %s)" .x }}`},
+		{name: "delimiter in string", src: `{{ printf("}} %s", .x) }}`, want: `{{ printf "}} %s" .x }}`},
+		{name: "escaped quote in string", src: `{{ printf("\"%s\", ", .x) }}`, want: `{{ printf "\"%s\", " .x }}`},
+		{name: "raw string", src: "{{ printf(`a, \"(b)\" %s`, .x) }}", want: "{{ printf `a, \"(b)\" %s` .x }}"},
+		{name: "char literal", src: `{{ eq(.c, ',') }}`, want: `{{ eq .c ',' }}`},
+		{name: "nested calls", src: `{{ upper(lower(.x)) }}`, want: `{{ upper (lower .x) }}`},
+		{name: "deeply nested calls", src: `{{ not(and(eq(.a, 1), .b)) }}`, want: `{{ not (and (eq .a 1) .b) }}`},
+		{name: "empty nested call", src: `{{ upper(now()) }}`, want: `{{ upper (now) }}`},
+		{name: "method call", src: `{{ .User.Name(1, 2) }}`, want: `{{ .User.Name 1 2 }}`},
+		{name: "variable method call", src: `{{ $user.Name(1) }}`, want: `{{ $user.Name 1 }}`},
+		{name: "chained field", src: `{{ .Map.Get("a").Name }}`, want: `{{ (.Map.Get "a").Name }}`},
+		{name: "chained method", src: `{{ .D.AddDate(1, 0, 0).Format("2006") }}`, want: `{{ (.D.AddDate 1 0 0).Format "2006" }}`},
+		{name: "chained methods", src: `{{ .a.b(1).c(2) }}`, want: `{{ (.a.b 1).c 2 }}`},
+		{name: "chained method argument", src: `{{ printf("%s", .D.AddDate(1, 0, 0).Format("2006")) }}`, want: `{{ printf "%s" ((.D.AddDate 1 0 0).Format "2006") }}`},
+		{name: "pipeline", src: `{{ lower(.x) | printf("%s!") }}`, want: `{{ lower .x | printf "%s!" }}`},
+		{name: "pipeline argument", src: `{{ printf("%s", .x | lower) }}`, want: `{{ printf "%s" (.x | lower) }}`},
+		{name: "command argument", src: `{{ printf("%d", len .x) }}`, want: `{{ printf "%d" (len .x) }}`},
+		{name: "parenthesized group", src: `{{ (upper("x")) }}`, want: `{{ (upper "x") }}`},
+		{name: "parenthesized pipeline", src: `{{ printf "%s" (lower .x) }}`, want: `{{ printf "%s" (lower .x) }}`},
+		{name: "call in group", src: `{{ printf "%s" (lower(.x)) }}`, want: `{{ printf "%s" (lower .x) }}`},
+		{name: "call as argument", src: `{{ printf "%s" lower(.x) }}`, want: `{{ printf "%s" (lower .x) }}`},
+		{name: "negative number", src: `{{ eq(.a, -1) }}`, want: `{{ eq .a -1 }}`},
+		{name: "float", src: `{{ printf("%.2f", 1.5e3) }}`, want: `{{ printf "%.2f" 1.5e3 }}`},
+		{name: "if", src: `{{ if eq(.a, 1) }}a{{ else if eq(.a, 2) }}b{{ end }}`, want: `{{ if eq .a 1 }}a{{ else if eq .a 2 }}b{{ end }}`},
+		{name: "keyword", src: `{{ if(.a) }}a{{ end }}`, want: `{{ if(.a) }}a{{ end }}`},
+		{name: "range", src: `{{ range $i, $v := split(.x, ",") }}{{ $v }}{{ end }}`, want: `{{ range $i, $v := split .x "," }}{{ $v }}{{ end }}`},
+		{name: "assignment", src: `{{ $x := upper(.a) }}{{ $x = lower(.a) }}`, want: `{{ $x := upper .a }}{{ $x = lower .a }}`},
+		{name: "template", src: `{{ template "x" upper(.a) }}`, want: `{{ template "x" upper .a }}`},
+		{name: "trim markers", src: `{{- upper("x") -}}`, want: `{{- upper "x" -}}`},
+		{name: "comment", src: `{{/* upper("a", "b") */}}`, want: `{{/* upper("a", "b") */}}`},
+		{name: "trimmed comment", src: `{{- /* upper("a", "b") */ -}}`, want: `{{- /* upper("a", "b") */ -}}`},
+		{name: "text", src: `fn(a, b) {{ .x }} (c)`, want: `fn(a, b) {{ .x }} (c)`},
+		{name: "multiple actions", src: `{{ upper(.a) }}-{{ lower(.b) }}`, want: `{{ upper .a }}-{{ lower .b }}`},
+		{name: "multiline", src: "{{ printf(\"%s %s\",\n\t.a,\n\t.b) }}\n{{ upper(.c) }}", want: "{{ printf \"%s %s\"\n.a\n.b }}\n{{ upper .c }}"},
+		{name: "unbalanced", src: `{{ upper(.a }}`, want: `{{ upper(.a }}`},
+		{name: "unterminated", src: `{{ upper(.a) `, want: `{{ upper(.a) `},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := translateFuncSyntax([]byte(tt.src), nil)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestFuncSyntaxRender(t *testing.T) {
+
+	xt := New(Config{RootFolder: "./samples", Ext: "html"})
+	data := map[string]interface{}{
+		"name": "Dinma", "age": 18, "tags": []string{"a", "b"},
+		"date": time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []renderCase{
+		{src: `{{ printf("a, b %s", .name) }}`, expected: "a, b Dinma"},
+		{src: `{{ upper(lower(.name)) }}`, expected: "DINMA"},
+		{src: `{{ lower(.name) | printf("%s!") }}`, expected: "dinma!"},
+		{src: `{{ printf("%d:%d", len .tags, index(.tags, 1) | len) }}`, expected: "2:1"},
+		{src: `{{ if eq(.age, 18) }}adult{{ end }}`, expected: "adult"},
+		{src: `{{ .date.AddDate(1, 0, 0).Format("2006") }}`, expected: "2021"},
+	}
+
+	renderCases(t, xt, data, tests)
+}
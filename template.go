@@ -2,15 +2,18 @@ package xtemplate
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html"
@@ -18,119 +21,239 @@ import (
 
 // XTemplate ...
 type XTemplate struct {
+	fs               fs.FS
 	rootFolder       string
 	partialsFolder   string
 	componentsFolder string
 	ext              string
-	shared           *template.Template
-	cache            map[string]*template.Template
-	funcs            template.FuncMap
-}
-
-// {{ ...  }}
-var lneRe = regexp.MustCompile(`{{.+?}}`)
-
-// fnMix("index.html", 2)
-var expRe = regexp.MustCompile(`([a-zA-Z]+[0-9]*)\((.+)\)`)
-
-// {{ extend "index.html" }}
-var actRe = regexp.MustCompile(`\-*[[:blank:]]*{{ *(.+?) *\"(.+?)\" *}}[[:blank:]]*[\r\n]*\-*`)
 
-// {{ template button(123) }}
-var tplRe = regexp.MustCompile(`{{\-*\s*(macro|template)\s*([a-zA-Z0-9\-_]+)\s*\((.*?)\)\s*\-*}}`)
+	// fmu guards shared, funcs, userFuncs, syn and components
+	fmu        sync.RWMutex
+	shared     *template.Template
+	funcs      template.FuncMap
+	userFuncs  map[string]bool
+	syn        *syntax
+	components map[string]interface{}
+
+	// mu guards cache and inflight
+	mu       sync.RWMutex
+	cache    map[string]*cacheEntry
+	inflight map[string]*parseCall
+	reload   bool
+
+	strict bool
+	// partials is set if the partials folder was configured
+	partials bool
+	warnFunc func(err error)
+}
 
 // <tag (attr)>(content)</tag>
 var tagRe = regexp.MustCompile(`<tag(\s+[^>]+)?>((.|\n)*?)</tag>([\s]*</tag>)?`)
 
-// {{template "tplName"}}
-// {{template "tplName" . }}
-// {{template "tplName" $ }}
-var tplRe2 = regexp.MustCompile(`{{\-*\s*template\s+"([\w/_.]+)"\s*([.$\w\s_"]*)\s*\-*}}`)
-
 type Config struct {
-	RootFolder       string
+	// FS is the file system templates are read from. when nil the
+	// templates are read from disk, relative to RootFolder
+	FS fs.FS
+	// RootFolder is the folder containing the templates. when FS is set
+	// it is a slash separated path within FS and defaults to "."
+	RootFolder string
+	// PartialsFolder and ComponentsFolder default to the _partials and
+	// _components sub folders of RootFolder and must be located within it
 	PartialsFolder   string
 	ComponentsFolder string
 	Ext              string
 	Funcs            template.FuncMap
+	// Reload enables development mode: a cached template is parsed again
+	// when one of the files it was built from changes
+	Reload bool
+	// Strict reports unknown components, slots the component doesn't define,
+	// a missing PartialsFolder (when set) and {{template}} actions naming
+	// neither a file nor a defined template as errors instead of ignoring them
+	Strict bool
+	// Warn is called with the warnings found while parsing templates e.g. an
+	// import hiding a template. they're logged when Warn is nil
+	Warn func(err error)
 }
 
 // New create new instance of XTemplate
 func New(cfg Config) *XTemplate {
 
 	xt := new(XTemplate)
-	xt.cache = make(map[string]*template.Template)
+	xt.cache = make(map[string]*cacheEntry)
+	xt.reload = cfg.Reload
+	xt.strict = cfg.Strict
+	xt.warnFunc = cfg.Warn
+	xt.partials = cfg.PartialsFolder != ""
+	xt.inflight = make(map[string]*parseCall)
+	xt.fs = cfg.FS
 	xt.rootFolder = cfg.RootFolder
-	if xt.rootFolder == "" {
-		xt.rootFolder = "./templates"
-	}
 	xt.partialsFolder = cfg.PartialsFolder
+	xt.componentsFolder = cfg.ComponentsFolder
+	if xt.fs == nil {
+		// read from disk: every folder becomes relative to the root folder
+		if xt.rootFolder == "" {
+			xt.rootFolder = "./templates"
+		}
+		xt.fs = os.DirFS(xt.rootFolder)
+		xt.partialsFolder = relFolder(xt.rootFolder, xt.partialsFolder)
+		xt.componentsFolder = relFolder(xt.rootFolder, xt.componentsFolder)
+		xt.rootFolder = "."
+	}
+
+	xt.rootFolder = cleanFolder(xt.rootFolder)
 	if xt.partialsFolder == "" {
-		xt.partialsFolder = filepath.Join(xt.rootFolder, "_partials")
+		xt.partialsFolder = path.Join(xt.rootFolder, "_partials")
 	}
-	xt.componentsFolder = cfg.ComponentsFolder
+	xt.partialsFolder = cleanFolder(xt.partialsFolder)
 	if xt.componentsFolder == "" {
-		xt.componentsFolder = filepath.Join(xt.rootFolder, "_components")
+		xt.componentsFolder = path.Join(xt.rootFolder, "_components")
 	}
+	xt.componentsFolder = cleanFolder(xt.componentsFolder)
 
 	xt.shared = template.New("")
+	xt.syn = defaultSyntax
+	xt.components = make(map[string]interface{})
 	xt.ext = cfg.Ext
 	if xt.ext == "" {
 		xt.ext = "html"
 	}
 
 	funcs := template.FuncMap{
-		"args":        args,
-		"kwargs":      kwargs,
-		"title":       capitalize,
-		"lower":       lower,
-		"upper":       upper,
-		"json":        marshalJSON,
-		"tag":         tags,
-		"nocache":     NoCache,
-		"ifEmpty":     IfEmpty,
-		"formatDate":  formatDate,
-		"formatCDate": formatCDate,
-		"isEmpty":     IsEmpty,
+		"args":         args,
+		"kwargs":       kwargs,
+		"title":        capitalize,
+		"lower":        lower,
+		"upper":        upper,
+		"json":         marshalJSON,
+		"tag":          tags,
+		"nocache":      NoCache,
+		"ifEmpty":      IfEmpty,
+		"formatDate":   formatDate,
+		"formatCDate":  formatCDate,
+		"isEmpty":      IsEmpty,
+		"super":        superFunc,
+		"slotScope":    slotScope,
+		"push":         pushFunc,
+		"pushEnd":      pushEnd,
+		"stack":        stackFunc,
+		"attrs":        attrsFunc,
+		"hasSlot":      hasSlot,
+		"includeScope": includeScope,
+		"withCaller":   withCaller,
+		// bound to each template, see bindComponents
+		"renderComponent": xt.componentFunc(context.Background(), nil),
+		"caller":          xt.callerFunc(nil),
+		// bound to each template, see bindMeta
+		"meta": metaFunc(nil),
 	}
 
 	xt.funcs = funcs
+	xt.userFuncs = make(map[string]bool)
 	if len(cfg.Funcs) > 0 {
 		for k, v := range cfg.Funcs {
 			xt.funcs[k] = v
+			xt.userFuncs[k] = true
 		}
 	}
 
-	xt.shared.Funcs(xt.funcs)
+	xt.shared.Funcs(xt.funcs).Funcs(contextFuncs(context.Background(), xt.funcs))
 	return xt
 }
 
-// Delims sets the template delimiters to the specified strings,
+// Delims sets the template delimiters to the specified strings, an empty
+// delimiter stands for the default ({{ or }}). The delimiters are used by
+// every action, including extends, include, macro and the component actions.
 // must be called before templates are parsed
 func (s *XTemplate) Delims(left, right string) *XTemplate {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+
+	if left == "" {
+		left = defaultDelims.left
+	}
+	if right == "" {
+		right = defaultDelims.right
+	}
+
 	s.shared.Delims(left, right)
+	s.syn = newSyntax(left, right)
 	return s
 }
 
+// syntax returns the preprocessor syntax of the configured delimiters
+func (s *XTemplate) syntax() *syntax {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	return s.syn
+}
+
 // Funcs adds the elements of the argument map to the template's function map.
+// functions whose first parameter is a context.Context receive the render's context.
 // must be called before templates are parsed
 func (s *XTemplate) Funcs(funcMap template.FuncMap) *XTemplate {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+
 	for k, v := range funcMap {
 		s.funcs[k] = v
+		s.userFuncs[k] = true
 	}
-	s.shared.Funcs(s.funcs)
+	s.shared.Funcs(funcMap).Funcs(contextFuncs(context.Background(), funcMap))
 	return s
 }
 
 // AddFunc add a function the template's function map.
 // must be called before templates are parsed
 func (s *XTemplate) AddFunc(name string, fn interface{}) *XTemplate {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+
 	s.funcs[name] = fn
-	s.shared.Funcs(s.funcs)
+	s.userFuncs[name] = true
+	funcMap := template.FuncMap{name: fn}
+	s.shared.Funcs(funcMap).Funcs(contextFuncs(context.Background(), funcMap))
 	return s
 }
 
+// userFunc reports whether the function name was registered by Config.Funcs, Funcs or AddFunc
+func (s *XTemplate) userFunc(name string) bool {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	return s.userFuncs[name]
+}
+
+// relFolder returns folder relative to root, folder is returned as is
+// if it is empty or can't be made relative to root
+func relFolder(root, folder string) string {
+	if folder == "" {
+		return ""
+	}
+
+	rel, err := filepath.Rel(root, folder)
+	if err != nil {
+		return folder
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// cleanFolder converts folder into a path that can be used with fs.FS
+func cleanFolder(folder string) string {
+	folder = path.Clean(filepath.ToSlash(folder))
+	folder = strings.TrimPrefix(folder, "/")
+	if folder == "" {
+		return "."
+	}
+
+	return folder
+}
+
 func (s *XTemplate) ListFuncs() {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
 	for k, v := range s.funcs {
 		fmt.Printf("\n %s - %T", k, v)
 	}
@@ -138,163 +261,236 @@ func (s *XTemplate) ListFuncs() {
 
 // Lookup returns the template with the given name in the cache
 func (s *XTemplate) Lookup(name string) *template.Template {
-	if _, found := s.cache[name]; !found {
+	entry, found := s.cached(s.cacheKey(name))
+	if !found {
 		return nil
 	}
 
-	return s.cache[name]
+	return entry.tpl
+}
+
+// lookupFunc returns the function registered under name
+func (s *XTemplate) lookupFunc(name string) interface{} {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	return s.funcs[name]
+}
+
+// cloneShared returns a copy of the shared template
+func (s *XTemplate) cloneShared() (*template.Template, error) {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+
+	return s.shared.Clone()
 }
 
 // ParseFile ...
 func (s *XTemplate) ParseFile(name string) error {
 	// parse template
-	tpl, err := s.getTemplate(name)
+	entry, err := s.newEntry(name)
 	if err != nil {
 		return err
 	}
 
 	// cache template
-	_, name = getFilename(s.rootFolder, name, s.ext)
-	s.cache[name] = tpl
+	s.store(s.cacheKey(name), entry)
 
 	return nil
 }
 
-// ParseDir parse all templates
-func (s *XTemplate) parseDir(root, extension string, onlyPartials bool) error {
-	// parse partial templates (i.e files that are named _xxxxx.ext)
-	_, err := s.shared.ParseGlob("_*")
-	if err != nil {
-		return err
-	}
+// ParseAll parses and caches every template in the root folder
+func (s *XTemplate) ParseAll() error {
+	return s.ParseDir("")
+}
 
-	if onlyPartials {
-		return err
-	}
+// ParseDir parses and caches every template in dir (a folder relative to the
+// root folder) and its sub folders. The partials and components folders and
+// files or folders whose names start with _ are skipped.
+// all templates are parsed, if any of them fail a ParseErrors listing
+// each failed template is returned
+func (s *XTemplate) ParseDir(dir string) error {
+	root := path.Join(s.rootFolder, dir)
+	var errs ParseErrors
 
 	// find all template files
-	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		// skip dirs
-		if info == nil || info.IsDir() {
-			return nil
+	err := fs.WalkDir(s.fs, root, func(fle string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
 
-		// check for extension
-		e := filepath.Ext(path)
-		if e != extension {
+		if d.IsDir() {
+			if fle != root && (fle == s.partialsFolder || fle == s.componentsFolder ||
+				strings.HasPrefix(d.Name(), "_")) {
+				return fs.SkipDir
+			}
 			return nil
 		}
 
-		name := strings.TrimPrefix(path, root)
-
-		if strings.HasPrefix(name, "_") {
+		// check for extension
+		if path.Ext(fle) != "."+s.ext || strings.HasPrefix(d.Name(), "_") {
 			return nil
 		}
 
+		name := s.relName(fle)
+
 		// parse template
-		tpl, err := s.getTemplate(name)
+		entry, err := s.newEntry(name)
 		if err != nil {
-			return err
+			errs = append(errs, &ParseError{Name: s.cacheKey(name), File: fle, Err: err})
+			return nil
 		}
 
 		// cache template
-		s.cache[name] = tpl
+		s.store(s.cacheKey(name), entry)
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
 }
 
 // Render parses a template then caches it. Will use cached version unless ignoreCache == true
-// if the template isnt found in the cache Render will attempt to locate it and parse
+// if the template isnt found in the cache Render will attempt to locate it and parse.
+// Render is safe for concurrent use
 func (s *XTemplate) Render(wr io.Writer, name string, data interface{}, ignoreCache bool) error {
 
 	var (
-		tpl   *template.Template
-		found bool
+		entry *cacheEntry
 		err   error
 	)
 
 	if ignoreCache {
 		// parse template
-		tpl, err = s.getTemplate(name)
-		if err != nil {
-			return err
-		}
-
+		entry, err = s.newEntry(name)
 	} else {
-		tpl, found = s.cache[name]
-		if !found {
-			// parse template
-			tpl, err = s.getTemplate(name)
-			if err != nil {
-				return err
-			}
+		// parse and cache the template if it isn't cached
+		entry, err = s.cachedTemplate(name)
+	}
+	if err != nil {
+		return err
+	}
 
-			// cache template
-			s.cache[name] = tpl
-		}
+	return s.execute(context.Background(), entry, wr, "", data)
+}
+
+// RenderContext renders template name like Render (using the cache), ctx is passed to
+// functions that take a context and execution stops with ctx's error once ctx is done
+func (s *XTemplate) RenderContext(ctx context.Context, wr io.Writer, name string, data interface{}) error {
+	entry, err := s.cachedTemplate(name)
+	if err != nil {
+		return err
 	}
 
-	if err = tpl.Execute(wr, data); err != nil {
+	return s.execute(ctx, entry, wr, "", data)
+}
+
+// RenderBlock renders only the named block (or defined template) of template name.
+// the template is resolved, parsed and cached as it is by Render so the block sees
+// the blocks overridden by the template, its masters and includes
+func (s *XTemplate) RenderBlock(wr io.Writer, name, block string, data interface{}) error {
+	return s.RenderBlockContext(context.Background(), wr, name, block, data)
+}
+
+// RenderBlockContext is RenderBlock with a context, see RenderContext
+func (s *XTemplate) RenderBlockContext(ctx context.Context, wr io.Writer, name, block string, data interface{}) error {
+	entry, err := s.cachedTemplate(name)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if entry.tpl.Lookup(block) == nil {
+		return fmt.Errorf("template %s: no block named %q", s.cacheKey(name), block)
+	}
+
+	return s.execute(ctx, entry, wr, block, data)
 }
 
+// stringTemplate is the name of templates rendered by RenderString
+const stringTemplate = "<string>"
+
 // RenderString renders a template from a string. supports the extend and include actions
 func (s *XTemplate) RenderString(tplStr string, data interface{}) (string, error) {
+	return s.RenderStringContext(context.Background(), tplStr, data)
+}
+
+// RenderStringContext is RenderString with a context, see RenderContext
+func (s *XTemplate) RenderStringContext(ctx context.Context, tplStr string, data interface{}) (string, error) {
 
 	var (
 		tpl *template.Template
 		err error
 	)
 
+	st := newParseState()
 	fleContent := []byte(tplStr)
 	var fm *frontMatter
-	fleContent, fm, err = preProcess(s, fleContent)
+	fleContent, fm, err = preProcess(s, st, stringTemplate, fleContent)
 	if err != nil {
 		return "", err
 	}
+	st.addMeta(fm)
 
-	if fm == nil {
-		tpl, err = s.shared.Clone()
+	if fm == nil || len(fm.Master) == 0 {
+		tpl, err = s.cloneShared()
 		if err != nil {
 			return "", err
 		}
 
-		_, err = tpl.Parse(string(fleContent))
+		_, err = st.parse(tpl, stringTemplate, fleContent)
 		if err != nil {
 			return "", err
 		}
-	} else if len(fm.Master) > 0 {
+	} else {
 		// get the master template
-		master, err := s.getTemplate(fm.Master)
+		master, err := s.getTemplate(st, fm.Master)
 		if err != nil {
 			return "", err
 		}
 
 		// have the master template use this template as an overlay
-		tpl, err = master.Parse(string(fleContent))
-		if err != nil {
+		if err = s.parseOverlay(st, master, stringTemplate, stringTemplate, fleContent); err != nil {
 			return "", err
 		}
+		tpl = master
 	}
 
 	if fm != nil && len(fm.Include) > 0 {
 		for i := range fm.Include {
-			fm.Include[i] = IncludeFile(filepath.Join(s.rootFolder, string(fm.Include[i])))
+			fm.Include[i] = IncludeFile(path.Join(s.rootFolder, string(fm.Include[i])))
 		}
-		_, err = parseFiles(s, tpl, s.rootFolder, s.ext, fm.Include...)
+		_, err = parseFiles(s, st, tpl, s.rootFolder, s.ext, fm.Include...)
 		if err != nil {
 			return "", err
 		}
 	}
 
+	if err = s.parseImports(st, tpl); err != nil {
+		return "", err
+	}
+	if err = s.bindMacros(st, tpl); err != nil {
+		return "", err
+	}
+	if err = s.checkRefs(st, tpl); err != nil {
+		return "", err
+	}
+
+	if ctx != context.Background() {
+		// the template hasn't been executed, its functions can be bound directly
+		tpl.Funcs(s.contextFuncs(ctx))
+	}
+	s.bindComponents(ctx, s.bindMeta(tpl, st.meta))
+
 	buff := bytes.NewBufferString("")
-	if err = tpl.Execute(buff, data); err != nil {
+	entry := &cacheEntry{tpl: tpl, src: st.src, stacks: st.stacks, meta: st.meta}
+	if err = s.execute(ctx, entry, buff, "", data); err != nil {
 		return "", err
 	}
 
@@ -303,13 +499,179 @@ func (s *XTemplate) RenderString(tplStr string, data interface{}) (string, error
 	return retv, nil
 }
 
+// parseState holds the state of a single template resolution
+type parseState struct {
+	// deps lists the files read while resolving the template
+	deps map[string]fileStamp
+	// src holds the sources of the files used to build the template
+	src *sources
+	// chain lists the files being resolved, i.e. a file, the file it extends or includes...
+	chain []string
+	// refs lists the {{template "name"}} actions that don't name a file
+	refs []templateRef
+	// stacks is set if content is pushed to stacks, or stacks are rendered
+	stacks bool
+	// meta holds the metadata of the template and its masters
+	meta map[string]interface{}
+	// imports lists the {{ import }} actions of the files
+	imports []templateImport
+	// macros holds the signatures of the macros declared with defmacro
+	macros map[string]*macroSig
+	// callers counts the bodies of the {{ call }} actions
+	callers int
+}
+
+// templateRef is a {{template "name"}} action in file
+type templateRef struct {
+	name string
+	file string
+}
+
+func newParseState() *parseState {
+	return &parseState{
+		deps:   map[string]fileStamp{},
+		src:    newSources(),
+		meta:   map[string]interface{}{},
+		macros: map[string]*macroSig{},
+	}
+}
+
+// readFile reads the named file from fsys and records it as a dependency
+func (st *parseState) readFile(fsys fs.FS, name string) ([]byte, error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			st.missing(name)
+		}
+		return nil, err
+	}
+
+	if st != nil {
+		st.deps[name] = newFileStamp(fsys, name, content)
+	}
+
+	return content, nil
+}
+
+// missing records that file name doesn't exist, the template has to be
+// parsed again once it does
+func (st *parseState) missing(name string) {
+	if st == nil {
+		return
+	}
+
+	if _, found := st.deps[name]; !found {
+		st.deps[name] = absentStamp
+	}
+}
+
+// enter adds file to the resolution chain. an error showing the cycle
+// is returned if file is already being resolved
+func (st *parseState) enter(kind, file string) error {
+	if st == nil {
+		return nil
+	}
+
+	for i, f := range st.chain {
+		if f == file {
+			cycle := append(append([]string{}, st.chain[i:]...), file)
+			return fmt.Errorf("circular %s: %s", kind, strings.Join(cycle, " → "))
+		}
+	}
+
+	st.chain = append(st.chain, file)
+	return nil
+}
+
+// leave removes the last file added to the resolution chain
+func (st *parseState) leave() {
+	if st != nil && len(st.chain) > 0 {
+		st.chain = st.chain[:len(st.chain)-1]
+	}
+}
+
+// useStacks records that stacks are used by the template
+func (st *parseState) useStacks() {
+	if st != nil {
+		st.stacks = true
+	}
+}
+
+// current returns the file being resolved
+func (st *parseState) current() string {
+	if st == nil || len(st.chain) == 0 {
+		return ""
+	}
+
+	return st.chain[len(st.chain)-1]
+}
+
+// checkRefs returns an error, in strict mode, if a {{template "name"}} action
+// recorded in st names a template that isn't defined in tpl
+func (s *XTemplate) checkRefs(st *parseState, tpl *template.Template) error {
+	if !s.strict {
+		return nil
+	}
+
+	for _, ref := range st.refs {
+		if tpl.Lookup(ref.name) != nil {
+			continue
+		}
+
+		file := ref.file
+		if file == "" {
+			file = stringTemplate
+		}
+		return fmt.Errorf("template %s: no file or template named %q", file, ref.name)
+	}
+
+	return nil
+}
+
+// resolving reports whether file is in the resolution chain
+func (st *parseState) resolving(file string) bool {
+	return st != nil && StrListIncludes(file, st.chain)
+}
+
+// addSource records the original and preprocessed content of file
+func (st *parseState) addSource(file string, original, processed []byte, m srcMap) {
+	if st != nil {
+		st.src.add(file, original, processed, m)
+	}
+}
+
+// parse parses the preprocessed content of file into t, parse errors
+// refer to the original content of the file
+func (st *parseState) parse(t *template.Template, file string, content []byte) (*template.Template, error) {
+	var err error
+	if st == nil {
+		t, err = t.Parse(string(content))
+	} else {
+		t, err = st.src.parse(t, t.Name(), file, content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = resolvePushes(t); err != nil {
+		if st == nil {
+			return nil, err
+		}
+		return nil, st.src.wrap(err)
+	}
+
+	return t, nil
+}
+
 type frontMatter struct {
 	Master  string        `yaml:"master"`
 	Include []IncludeFile `yaml:"include"`
+	// Meta holds the other values of a YAML front matter
+	Meta map[string]interface{} `yaml:",inline"`
 }
 
 func getFilename(folder, name, ext string) (fileName string, tplName string) {
-	fle := filepath.Join(folder, name)
+	fle := path.Join(folder, name)
 	// add a file extension if one isn't provided
 	if !strings.HasSuffix(name, "."+ext) {
 		fle += "." + ext
@@ -323,11 +685,18 @@ func getFilename(folder, name, ext string) (fileName string, tplName string) {
 	return fle, name
 }
 
-func (s *XTemplate) getTemplate(name string) (*template.Template, error) {
-	tplName, fm, fleContent, err := s.readTemplate(name)
+func (s *XTemplate) getTemplate(st *parseState, name string) (*template.Template, error) {
+	fle, _ := getFilename(s.rootFolder, name, s.ext)
+	if err := st.enter("extends", s.relName(fle)); err != nil {
+		return nil, err
+	}
+	defer st.leave()
+
+	fle, tplName, fm, fleContent, err := s.readTemplate(st, name)
 	if err != nil {
 		return nil, err
 	}
+	st.addMeta(fm)
 
 	/*	// if template doesn't contains front matter
 		if fm == nil {
@@ -344,24 +713,24 @@ func (s *XTemplate) getTemplate(name string) (*template.Template, error) {
 
 	if fm != nil && len(fm.Master) > 0 {
 		// get the master template
-		master, err := s.getTemplate(fm.Master)
+		master, err := s.getTemplate(st, fm.Master)
 		if err != nil {
 			return nil, err
 		}
 
 		// have the master template use this template as an overlay
-		tpl, err = master.Parse(string(fleContent))
-		if err != nil {
+		if err = s.parseOverlay(st, master, tplName, fle, fleContent); err != nil {
 			return nil, err
 		}
+		tpl = master
 	} else {
 		// create template
-		tpl, err = s.makeTemplate(tplName, fleContent)
+		tpl, err = s.makeTemplate(st, fle, tplName, fleContent)
 		if err != nil {
 			return nil, err
 		}
 
-		if err := s.parsePartials(tpl); err != nil {
+		if err := s.parsePartials(st, tpl); err != nil {
 			return nil, err
 		}
 	}
@@ -376,9 +745,9 @@ func (s *XTemplate) getTemplate(name string) (*template.Template, error) {
 				continue
 			}
 
-			fm.Include[i] = IncludeFile(filepath.Join(s.rootFolder, iNme))
+			fm.Include[i] = IncludeFile(path.Join(s.rootFolder, iNme))
 		}
-		_, err = parseFiles(s, tpl, s.rootFolder, s.ext, fm.Include...)
+		_, err = parseFiles(s, st, tpl, s.rootFolder, s.ext, fm.Include...)
 		if err != nil {
 			return nil, err
 		}
@@ -387,18 +756,17 @@ func (s *XTemplate) getTemplate(name string) (*template.Template, error) {
 	return tpl, nil
 }
 
-func (s *XTemplate) readTemplate(name string) (tplName string, fm *frontMatter, content []byte, err error) {
-	var fle string
+func (s *XTemplate) readTemplate(st *parseState, name string) (fle, tplName string, fm *frontMatter, content []byte, err error) {
 	fle, tplName = getFilename(s.rootFolder, name, s.ext)
 
 	// read template into a buffer
-	content, err = ioutil.ReadFile(fle)
+	content, err = st.readFile(s.fs, fle)
 	if err != nil {
 		return
 	}
 
 	// convert extras into standard go template
-	content, fm, err = preProcess(s, content)
+	content, fm, err = preProcess(s, st, fle, content)
 	if err != nil {
 		return
 	}
@@ -406,8 +774,8 @@ func (s *XTemplate) readTemplate(name string) (tplName string, fm *frontMatter,
 	return
 }
 
-func (s *XTemplate) makeTemplate(name string, content []byte) (*template.Template, error) {
-	tpl, err := s.shared.Clone()
+func (s *XTemplate) makeTemplate(st *parseState, fle, name string, content []byte) (*template.Template, error) {
+	tpl, err := s.cloneShared()
 	if err != nil {
 		return nil, err
 	}
@@ -416,26 +784,36 @@ func (s *XTemplate) makeTemplate(name string, content []byte) (*template.Templat
 		return tpl.New(name), nil
 	}
 
-	return tpl.New(name).Parse(string(content))
+	return st.parse(tpl.New(name), fle, content)
 }
 
-func (s *XTemplate) parsePartials(tpl *template.Template) error {
-	path := filepath.Join(s.partialsFolder)
-	fi, err := os.Lstat(path)
-	if err != nil {
-		return nil
+func (s *XTemplate) parsePartials(st *parseState, tpl *template.Template) error {
+	fi, err := fs.Stat(s.fs, s.partialsFolder)
+	if st != nil {
+		// adding or removing a partial changes the template
+		if err == nil {
+			st.deps[s.partialsFolder] = newDirStamp(s.fs, s.partialsFolder)
+		} else {
+			st.missing(s.partialsFolder)
+		}
+	}
+	if err == nil && !fi.IsDir() {
+		err = fmt.Errorf("%s isn't a folder", s.partialsFolder)
 	}
-	if !fi.IsDir() {
+	if err != nil {
+		if s.strict && s.partials {
+			return fmt.Errorf("partials folder: %w", err)
+		}
 		return nil
 	}
 
-	root := strings.TrimPrefix(s.rootFolder, "/")
-	root = strings.TrimPrefix(root, "./")
+	err = fs.WalkDir(s.fs, s.partialsFolder, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-	// _, err = tpl.ParseGlob(path + "/*." + s.ext)
-	err = filepath.Walk(path, func(name string, info fs.FileInfo, err error) error {
 		// skip folders
-		if info.IsDir() {
+		if d.IsDir() {
 			return nil
 		}
 
@@ -444,15 +822,13 @@ func (s *XTemplate) parsePartials(tpl *template.Template) error {
 			return nil
 		}
 
-		// log.Println(s.folder, name, info.Name(), strings.TrimPrefix(name, root))
-
-		_, _, content, err := s.readTemplate(strings.TrimPrefix(name, root))
+		_, _, _, content, err := s.readTemplate(st, s.relName(name))
 		if err != nil {
 			return err
 		}
 
 		tplName := strings.TrimSuffix(strings.TrimPrefix(name, s.partialsFolder+"/"), "."+s.ext)
-		_, err = tpl.New(tplName).Parse(string(content))
+		_, err = st.parse(tpl.New(tplName), name, content)
 		if err != nil {
 			return err
 		}
@@ -466,6 +842,15 @@ func (s *XTemplate) parsePartials(tpl *template.Template) error {
 	return err
 }
 
+// relName returns the name of file fle relative to the root folder
+func (s *XTemplate) relName(fle string) string {
+	if s.rootFolder == "." {
+		return fle
+	}
+
+	return strings.TrimPrefix(fle, s.rootFolder+"/")
+}
+
 type IncludeFile string
 
 func (i IncludeFile) Name() string {
@@ -488,30 +873,42 @@ func (i *IncludeFile) SetTemplateActionFlag() {
 }
 
 // parseFiles expects filenames to have extensions
-func parseFiles(xt *XTemplate, t *template.Template, baseFolder, ext string, filenames ...IncludeFile) (*template.Template, error) {
-	baseFolder = filepath.Join(baseFolder) + "/"
+func parseFiles(xt *XTemplate, st *parseState, t *template.Template, baseFolder, ext string, filenames ...IncludeFile) (*template.Template, error) {
+	baseFolder = path.Join(baseFolder) + "/"
 
 	for _, filename := range filenames {
 
 		fName, name := getFilename("", filename.Name(), ext)
-		b, err := ioutil.ReadFile(fName)
+		if st.resolving(xt.relName(fName)) && filename.FromTemplateAction() {
+			// the template is referenced by a {{template "name"}} action
+			// within the file itself or a file it includes
+			continue
+		}
+		from := st.current()
+		if err := st.enter("include", xt.relName(fName)); err != nil {
+			return nil, err
+		}
+
+		b, err := st.readFile(xt.fs, fName)
 		if err != nil {
 			if filename.FromTemplateAction() {
 				// this template was referenced in a {{template "name"}} action
 				// and included by extractTemplates so it's possible that it's
 				// not an actual file but a template defined elsewhere
+				st.refs = append(st.refs, templateRef{name: strings.TrimPrefix(name, baseFolder), file: from})
+				st.leave()
 				continue
 			}
 
 			return nil, err
 		}
-		prd, _, err := preProcess(xt, b)
+		prd, fm, err := preProcess(xt, st, fName, b)
 		if err != nil {
 			return nil, err
 		}
 
 		s := string(prd)
-		name = strings.Replace(name, baseFolder, "", 1)
+		name = strings.TrimPrefix(name, baseFolder)
 		var tmpl *template.Template
 		if t == nil {
 			t = template.New(name)
@@ -521,16 +918,30 @@ func parseFiles(xt *XTemplate, t *template.Template, baseFolder, ext string, fil
 		} else {
 			tmpl = t.New(name)
 		}
-		_, err = tmpl.Parse(s)
+		_, err = st.parse(tmpl, fName, []byte(s))
 		if err != nil {
 			return nil, err
 		}
+
+		// parse the files it includes
+		if fm != nil && len(fm.Include) > 0 {
+			for i := range fm.Include {
+				fm.Include[i] = IncludeFile(path.Join(baseFolder, string(fm.Include[i])))
+			}
+			if _, err = parseFiles(xt, st, t, baseFolder, ext, fm.Include...); err != nil {
+				return nil, err
+			}
+		}
+
+		st.leave()
 	}
 
 	return t, nil
 }
 
-func preProcess(tpl *XTemplate, fleContent []byte) ([]byte, *frontMatter, error) {
+// preProcess converts the extras in the content of file into standard go template.
+// the original and converted content are recorded in st
+func preProcess(tpl *XTemplate, st *parseState, file string, fleContent []byte) ([]byte, *frontMatter, error) {
 
 	// extract front matter
 	var (
@@ -538,25 +949,69 @@ func preProcess(tpl *XTemplate, fleContent []byte) ([]byte, *frontMatter, error)
 		err error
 	)
 
-	fm, fleContent = extractFrontMatter(actRe, fleContent)
+	sx := tpl.syntax()
+	original := fleContent
+	m := newSrcMap(file, fleContent, nil)
+
+	var yfm *frontMatter
+	yfm, fleContent, m, err = extractYAMLFrontMatter(fleContent, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fm, fleContent, m = extractFrontMatter(sx.actRe, fleContent, m)
+	fm = yfm.merge(fm)
 
 	// add template "name" to includes
-	fm = extractTemplates(tplRe2, fm, fleContent)
+	fm = extractTemplates(sx.tplRe2, fm, fleContent)
 
-	fleContent, err = translateComponents(tpl, fleContent)
+	// {{ include "name" with .Data }} --> {{ template "name" includeScope . (.Data) }}
+	fm, fleContent, m, err = translateIncludes(tpl, st, fm, fleContent, m)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// {{ import "forms.html" as f }}
+	var imports map[string]string
+	imports, fleContent, m, err = translateImports(tpl, st, fleContent, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// {{ defmacro button(label, kind="primary") }} --> {{ define "button" }}
+	fleContent, m, err = translateDefMacros(tpl, st, fleContent, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// {{ push "name" }} --> {{ if push "name" }}
+	fleContent, m = sx.translatePush(fleContent, m)
+
+	fleContent, m, err = translateComponents(tpl, st, fleContent, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sx.usesStacks(fleContent) {
+		st.useStacks()
+	}
+
 	// <tag> --> tag .type .attr . content
-	fleContent = translateTags(tpl, fleContent)
+	fleContent, m = translateTags(tpl, fleContent, m)
+
+	// {{ call panel("title") }}body{{ end }} --> {{ template "panel" withCaller "panel__caller_1" . (kwargs) ("title") }}
+	fleContent, m, err = translateCalls(tpl, st, imports, fleContent, m)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// handle {{ template }}
-	fleContent = convertTemplateSyntax(tplRe, fleContent)
+	fleContent, m = convertTemplateSyntax(sx, imports, fleContent, m)
 
 	// translate function syntax sugar
 	// fn(arg1, arg2,...) --> fn arg1 arg2 ...
-	fleContent = translateFuncSyntax(fleContent)
+	fleContent, m = sx.translateFuncSyntax(fleContent, m)
+
+	st.addSource(file, original, fleContent, m)
 
 	// fmt.Println("\n>>>>\n", string(fleContent), "\n>>>>")
 	return fleContent, fm, nil
@@ -589,46 +1044,65 @@ func extractTemplates(re *regexp.Regexp, fm *frontMatter, fleContent []byte) *fr
 // {{ macro button("args") }} --> {{ template "button" "args" }}
 // {{ macro button("a",1,2) }} --> {{ template "button" args "a" 1 2 }}
 // {{ macro button("a"::1,"b"::22) }} --> {{ template "button" kwargs "a" 1 "b" 22 }}
-func convertTemplateSyntax(re *regexp.Regexp, src []byte) []byte {
-	retv := re.ReplaceAllFunc(src, func(b []byte) []byte {
+// {{ macro f.button("args") }} --> {{ template "forms.html#button" "args" }}, see translateImports
+func convertTemplateSyntax(sx *syntax, imports map[string]string, src []byte, m srcMap) ([]byte, srcMap) {
+	re := sx.tplRe
+	return replaceAllFunc(re, src, m, func(b []byte) []byte {
 		part := re.FindSubmatch(b)
 
 		retStr := ""
 		if len(part) == 3 {
-			retStr = fmt.Sprintf("{{ template \"%s\" -}}", string(part[2]))
+			retStr = sx.action(" template \"%s\" -", macroName(imports, string(part[2])))
 		} else if len(part) == 4 {
-			if bytes.Count(part[3], []byte("::")) > 0 {
-				arg := bytes.TrimSpace(bytes.Replace(part[3], []byte("::"), []byte(" "), -1))
-				arg = bytes.TrimSpace(bytes.Replace(arg, []byte(","), []byte(" "), -1))
-				retStr = fmt.Sprintf("{{ template \"%s\" kwargs %s -}}", string(part[2]), string(arg))
-			} else if bytes.Count(part[3], []byte(",")) > 0 {
-				arg := bytes.TrimSpace(bytes.Replace(part[3], []byte(","), []byte(" "), -1))
-				retStr = fmt.Sprintf("{{ template \"%s\" args %s -}}", string(part[2]), string(arg))
-			} else {
-				arg := part[3]
-				retStr = fmt.Sprintf("{{ template \"%s\" %s -}}", string(part[2]), string(arg))
-			}
+			retStr = sx.action(" template \"%s\" %s -", macroName(imports, string(part[2])), macroArgs(part[3]))
 		}
 		return []byte(retStr)
 	})
-
-	return retv
 }
 
-// translateFuncSyntax
-// fn(arg1, arg2,...) --> fn arg1 arg2 ...
-func translateFuncSyntax(src []byte) []byte {
-	retv := lneRe.ReplaceAllFunc([]byte(src), func(b []byte) []byte {
-		return expRe.ReplaceAllFunc([]byte(b), func(b2 []byte) []byte {
-			rv := bytes.Replace(
-				bytes.Replace(b2, []byte(","), []byte(" "), -1),
-				[]byte("("), []byte(" "), 1,
-			)
-			return bytes.Replace(rv, []byte(")"), []byte(""), 1)
-		})
-	})
+// macroArgs converts the arguments of a macro call into a pipeline
+// ("a"::1,"b"::22) --> kwargs "a" 1 "b" 22, ("a",1,2) --> args "a" 1 2.
+// the arguments are tokenized so commas and colons within strings and
+// parenthesized pipelines don't separate arguments
+func macroArgs(arg []byte) string {
+	var (
+		out          strings.Builder
+		depth        int
+		kwargs, list bool
+	)
+
+	for rest := arg; len(rest) > 0; {
+		tok, ok := lexToken(rest)
+		if !ok {
+			// unterminated string, leave it for the parser to report
+			return string(arg)
+		}
+		rest = rest[len(tok.text):]
+
+		switch {
+		case tok.typ == tokLParen:
+			depth++
+		case tok.typ == tokRParen:
+			depth--
+		case depth > 0:
+		case tok.typ == tokComma:
+			tok.text, list = " ", true
+		case tok.text == ":" && bytes.HasPrefix(rest, []byte(":")):
+			rest = rest[1:]
+			tok.text, kwargs = " ", true
+		}
+		out.WriteString(tok.text)
+	}
 
-	return retv
+	retv := strings.TrimSpace(out.String())
+	switch {
+	case kwargs:
+		return "kwargs " + retv
+	case list:
+		return "args " + retv
+	}
+
+	return string(arg)
 }
 
 /*
@@ -644,7 +1118,7 @@ func translateFuncSyntax(src []byte) []byte {
   </tag>
  </tag>
 */
-func translateTags(xt *XTemplate, src []byte, mode ...int) []byte {
+func translateTags(xt *XTemplate, src []byte, m srcMap) ([]byte, srcMap) {
 	// match <tag></tag>
 	proc := func(b []byte) []byte {
 		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(b))
@@ -671,7 +1145,7 @@ func translateTags(xt *XTemplate, src []byte, mode ...int) []byte {
 			attrMap[i.Key] = i.Val
 		}
 
-		tagFunc, valid := xt.funcs["tag"].(func(typ string, attr map[string]interface{}, content string) template.HTML)
+		tagFunc, valid := xt.lookupFunc("tag").(func(typ string, attr map[string]interface{}, content string) template.HTML)
 		if !valid {
 			return b
 		}
@@ -680,21 +1154,20 @@ func translateTags(xt *XTemplate, src []byte, mode ...int) []byte {
 
 		// check if tag output includes tag construct
 		if tagRe.Match([]byte(retv)) {
-			retv = string(translateTags(xt, []byte(retv)))
+			out, _ := translateTags(xt, []byte(retv), nil)
+			retv = string(out)
 		}
 
 		// fmt.Println("\n\nsrc: ", string(b), "\nretv: ", retv)
 		return []byte(retv)
 	}
 
-	retv := tagRe.ReplaceAllFunc(src, proc)
-
-	return retv
+	return replaceAllFunc(tagRe, src, m, proc)
 }
 
-func extractFrontMatter(re *regexp.Regexp, src []byte) (*frontMatter, []byte) {
+func extractFrontMatter(re *regexp.Regexp, src []byte, m srcMap) (*frontMatter, []byte, srcMap) {
 	fm := &frontMatter{}
-	retv := re.ReplaceAllFunc(src, func(b []byte) []byte {
+	retv, m := replaceAllFunc(re, src, m, func(b []byte) []byte {
 		parts := re.FindSubmatch(b)
 
 		if len(parts) < 3 {
@@ -708,6 +1181,10 @@ func extractFrontMatter(re *regexp.Regexp, src []byte) (*frontMatter, []byte) {
 			return []byte("")
 
 		case "include":
+			if bytes.ContainsRune(parts[2], '"') {
+				// an inline include of several names
+				return b
+			}
 			fm.Include = append(fm.Include, IncludeFile(parts[2]))
 			return []byte("")
 		}
@@ -719,5 +1196,5 @@ func extractFrontMatter(re *regexp.Regexp, src []byte) (*frontMatter, []byte) {
 		fm = nil
 	}
 
-	return fm, retv
+	return fm, retv, m
 }
@@ -3,6 +3,7 @@ package xtemplate
 import (
 	"bytes"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -172,7 +173,8 @@ func TestTranslateTags(t *testing.T) {
 		<tag type="input" value="abc"></tag>
 	</tag>
 	`)
-	retv := string(translateTags(xt, src, 1))
+	out, _ := translateTags(xt, src, nil)
+	retv := string(out)
 
 	exp := "\n\t<input class=\"red sm:red\"></input>\n\t<input x-data=\"{'a':1}\"></input>\n\n\t<p >{{.Name}}</p>\n\t<div >\n\t\t<input value=\"abc\"></input>\n\t</div>\n\t"
 	assert.Equal(t, exp, retv)
@@ -319,3 +321,169 @@ func Test_getFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestFS(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/master.html":            {Data: []byte(`<h1>{{block "title" .}}master{{end}}</h1>{{template "footer" .}}`)},
+		"views/page.html":              {Data: []byte(`{{extends "master.html"}}{{define "title"}}{{ upper(.name) }}{{end}}`)},
+		"views/card.html":              {Data: []byte(`<component type="card">{{.ctx.name}}</component>{{template "footer" .}}`)},
+		"views/_partials/footer.html":  {Data: []byte(`{{define "footer"}}<footer>{{.}}</footer>{{end}}`)},
+		"views/_components/card.html":  {Data: []byte(`<div class="card">{{block "#slot--default" .}}{{end}}</div>`)},
+		"views/_components/other.html": {Data: []byte(`other`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views", Ext: "html"})
+	data := map[string]interface{}{"name": "dinma"}
+
+	tests := []struct {
+		name     string
+		tpl      string
+		expected string
+	}{
+		{name: "extends", tpl: "page", expected: "<h1>DINMA</h1><footer>map[name:dinma]</footer>"},
+		{name: "components", tpl: "card.html", expected: "<div class=\"card\">dinma</div>\n<footer>map[name:dinma]</footer>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := bytes.NewBufferString("")
+			if err := xt.Render(buff, tt.tpl, data, false); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.expected, buff.String())
+		})
+	}
+
+	buff := bytes.NewBufferString("")
+	assert.Error(t, xt.Render(buff, "missing", data, false))
+}
+
+func TestParseAll(t *testing.T) {
+
+	xt := New(Config{RootFolder: "./samples", Ext: "html"})
+	assert.NoError(t, xt.ParseAll())
+	for _, name := range []string{"plain", "overlay", "sub/plain", "sub/overlay4", "subs/include.partial"} {
+		assert.NotNil(t, xt.Lookup(name), name)
+	}
+	assert.Nil(t, xt.Lookup("_partials/lorem"))
+	assert.Nil(t, xt.Lookup("_components/card"))
+
+	fsys := fstest.MapFS{
+		"views/ok.html":               {Data: []byte(`ok`)},
+		"views/broken.html":           {Data: []byte(`{{ if .x }}`)},
+		"views/sub/broken.html":       {Data: []byte(`{{ .x }`)},
+		"views/sub/ok.html":           {Data: []byte(`ok`)},
+		"views/_components/card.html": {Data: []byte(`{{end}}`)},
+		"views/_drafts/draft.html":    {Data: []byte(`{{end}}`)},
+	}
+	xt = New(Config{FS: fsys, RootFolder: "views", Ext: "html"})
+	err := xt.ParseAll()
+	if assert.Error(t, err) {
+		errs, ok := err.(ParseErrors)
+		assert.True(t, ok)
+		assert.Len(t, errs, 2)
+		assert.Contains(t, err.Error(), "2 templates failed to parse")
+		assert.Contains(t, err.Error(), "views/broken.html: ")
+		assert.Contains(t, err.Error(), "views/sub/broken.html: ")
+	}
+	assert.NotNil(t, xt.Lookup("ok"))
+	assert.NotNil(t, xt.Lookup("sub/ok"))
+
+	xt = New(Config{FS: fsys, RootFolder: "views", Ext: "html"})
+	assert.Error(t, xt.ParseDir("none"))
+	err = xt.ParseDir("sub")
+	if assert.Error(t, err) {
+		assert.Len(t, err.(ParseErrors), 1)
+	}
+	assert.Nil(t, xt.Lookup("ok"))
+}
+
+func TestCircularReferences(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/a.html":                 {Data: []byte(`{{extends "b.html"}}`)},
+		"views/b.html":                 {Data: []byte(`{{extends "sub/c.html"}}`)},
+		"views/sub/c.html":             {Data: []byte(`{{extends "a.html"}}`)},
+		"views/self.html":              {Data: []byte(`{{extends "self.html"}}`)},
+		"views/x.html":                 {Data: []byte(`{{include "y.html"}}x`)},
+		"views/y.html":                 {Data: []byte(`{{include "x.html"}}y`)},
+		"views/page.html":              {Data: []byte(`{{include "one.html"}}{{template "two" .}} {{template "tree" .list}}`)},
+		"views/one.html":               {Data: []byte(`{{include "two.html"}}{{include "tree.html"}}`)},
+		"views/two.html":               {Data: []byte(`{{define "two"}}two{{end}}`)},
+		"views/tree.html":              {Data: []byte(`{{define "tree"}}[{{range .}}{{template "tree" .}}{{end}}]{{end}}`)},
+		"views/card.html":              {Data: []byte(`<component type="card"></component>`)},
+		"views/_components/card.html":  {Data: []byte(`<div><component type="inner"></component></div>`)},
+		"views/_components/inner.html": {Data: []byte(`<component type="card"></component>`)},
+	}
+
+	xt := New(Config{FS: fsys, RootFolder: "views", Ext: "html"})
+	data := map[string]interface{}{"list": [][]interface{}{{}, {}}}
+
+	tests := []struct {
+		name     string
+		tpl      string
+		expected string
+		err      string
+	}{
+		{name: "extends", tpl: "a", err: "circular extends: a.html → b.html → sub/c.html → a.html"},
+		{name: "self", tpl: "self", err: "circular extends: self.html → self.html"},
+		{name: "include", tpl: "x", err: "circular include: x.html → y.html → x.html"},
+		{name: "component", tpl: "card", err: "circular component: _components/card.html → _components/inner.html → _components/card.html"},
+		{name: "nested includes", tpl: "page", expected: "two [[][]]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := bytes.NewBufferString("")
+			err := xt.Render(buff, tt.tpl, data, false)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, buff.String())
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"views/_components/card.html": {Data: []byte(`<div>{{block "#slot--body" .}}{{end}}</div>`)},
+		"views/typo.html":             {Data: []byte("<p>\n<component type=\"crad\"></component>\n</p>")},
+		"views/slot.html":             {Data: []byte("<component type=\"card\">\n\t<slot name=\"title\">hi</slot>\n</component>")},
+		"views/ref.html":              {Data: []byte(`{{ template "nav" . }}`)},
+		"views/defined.html":          {Data: []byte(`{{ define "nav" }}nav{{ end }}{{ template "nav" . }}`)},
+	}
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{name: "typo", err: `template: views/typo.html:2: unknown component "crad": views/_components/crad.html not found`},
+		{name: "slot", err: `template: views/slot.html:2: component card has no slot "title"`},
+		{name: "ref", err: `template ref.html: no file or template named "nav"`},
+		{name: "defined"},
+	}
+
+	lax := New(Config{FS: fsys, RootFolder: "views"})
+	strict := New(Config{FS: fsys, RootFolder: "views", Strict: true})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, lax.ParseFile(tt.name))
+
+			err := strict.ParseFile(tt.name)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	// only a configured partials folder must exist
+	xt := New(Config{FS: fsys, RootFolder: "views", PartialsFolder: "views/partials", Strict: true})
+	assert.Error(t, xt.ParseFile("defined"))
+}